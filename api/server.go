@@ -1,9 +1,13 @@
 package api
 
 import (
-	"log"
+	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/dbkbali/bcbasic/core"
+	"github.com/dbkbali/bcbasic/types"
+	"github.com/go-kit/log"
 	"github.com/labstack/echo"
 )
 
@@ -14,11 +18,13 @@ type ServerConfig struct {
 
 type Server struct {
 	ServerConfig
+	bc *core.Blockchain
 }
 
-func NewServer(cfg ServerConfig) *Server {
+func NewServer(cfg ServerConfig, bc *core.Blockchain) *Server {
 	return &Server{
 		ServerConfig: cfg,
+		bc:           bc,
 	}
 }
 
@@ -26,6 +32,8 @@ func (s *Server) Start() error {
 	e := echo.New()
 
 	e.GET("/block/:hashorid", s.handleGetBlock)
+	e.GET("/tx/:hash", s.handleGetTx)
+	e.GET("/account/:address", s.handleGetAccount)
 
 	return e.Start(s.ListenAddr)
 }
@@ -33,5 +41,64 @@ func (s *Server) Start() error {
 func (s *Server) handleGetBlock(c echo.Context) error {
 	hashOrID := c.Param("hashorid")
 
-	return c.JSON(http.StatusOK, map[string]any{"mdg": "server working"})
+	var (
+		block *core.Block
+		err   error
+	)
+
+	if height, convErr := strconv.ParseUint(hashOrID, 10, 32); convErr == nil {
+		block, err = s.bc.GetBlock(uint32(height))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]any{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, block)
+	}
+
+	hash, err := types.HashFromHex(hashOrID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{"error": "expected a block height or hash"})
+	}
+
+	block, err = s.bc.GetBlockByHash(hash)
+	if err != nil {
+		if errors.Is(err, core.ErrUnknownHash) {
+			return c.JSON(http.StatusNotFound, map[string]any{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, block)
+}
+
+func (s *Server) handleGetTx(c echo.Context) error {
+	hash, err := types.HashFromHex(c.Param("hash"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{"error": "expected a transaction hash"})
+	}
+
+	tx, err := s.bc.GetTransaction(hash)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]any{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, tx)
+}
+
+func (s *Server) handleGetAccount(c echo.Context) error {
+	addr, err := types.ParseAddress(c.Param("address"), s.bc.ChainID())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+	}
+
+	account, err := s.bc.GetAccount(addr)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"address": addr.Bech32(types.AddressPrefix(s.bc.ChainID())),
+		"balance": account.Balance,
+		"nonce":   account.Nonce,
+	})
 }
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+type Account struct {
+	Balance uint64
+	// Nonce is the nonce the next transaction of the account must carry
+	Nonce uint64
+}
+
+// GenesisAlloc is the initial balance of every funded account.
+type GenesisAlloc map[types.Address]uint64
+
+func (a *Account) Bytes() []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[0:8], a.Balance)
+	binary.BigEndian.PutUint64(buf[8:16], a.Nonce)
+
+	return buf
+}
+
+func accountFromBytes(b []byte) (*Account, error) {
+	if len(b) != 16 {
+		return nil, fmt.Errorf("invalid account encoding length %d", len(b))
+	}
+
+	return &Account{
+		Balance: binary.BigEndian.Uint64(b[0:8]),
+		Nonce:   binary.BigEndian.Uint64(b[8:16]),
+	}, nil
+}
+
+// GetAccount returns the account of addr. Unknown addresses have an empty
+// account.
+func (s *State) GetAccount(addr types.Address) (*Account, error) {
+	value, ok := s.data[accountKey(addr)]
+	if !ok {
+		return &Account{}, nil
+	}
+
+	return accountFromBytes(value)
+}
+
+// GetAccountProof returns a proof of the account of addr against the current
+// root.
+func (s *State) GetAccountProof(addr types.Address) (*StateProof, error) {
+	return s.proof(accountKey(addr)), nil
+}
+
+// AddBalance credits amount to the account of addr.
+func (s *State) AddBalance(addr types.Address, amount uint64) error {
+	if amount == 0 {
+		return nil
+	}
+
+	acc, err := s.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+
+	if acc.Balance+amount < acc.Balance {
+		return fmt.Errorf("balance of [%s] overflows", addr)
+	}
+	acc.Balance += amount
+
+	return s.putAccount(addr, acc)
+}
+
+// SubBalance debits amount from the account of addr.
+func (s *State) SubBalance(addr types.Address, amount uint64) error {
+	if amount == 0 {
+		return nil
+	}
+
+	acc, err := s.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+
+	if acc.Balance < amount {
+		return fmt.Errorf("%w: [%s] has [%d] - needs [%d]", ErrInsufficientBalance, addr, acc.Balance, amount)
+	}
+	acc.Balance -= amount
+
+	return s.putAccount(addr, acc)
+}
+
+// UseNonce checks that nonce is the next nonce of addr and increments it.
+func (s *State) UseNonce(addr types.Address, nonce uint64) error {
+	acc, err := s.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+
+	if err := CheckNonce(addr, acc.Nonce, nonce); err != nil {
+		return err
+	}
+	acc.Nonce++
+
+	return s.putAccount(addr, acc)
+}
+
+// Transfer moves amount from one account to another.
+func (s *State) Transfer(from, to types.Address, amount uint64) error {
+	if err := s.SubBalance(from, amount); err != nil {
+		return err
+	}
+
+	return s.AddBalance(to, amount)
+}
+
+func (s *State) putAccount(addr types.Address, acc *Account) error {
+	key := accountKey(addr)
+	s.record(key)
+	s.set(key, acc.Bytes())
+
+	return nil
+}
+
+// Transactions returns the transactions that mint the allocation in the
+// genesis block, ordered by address.
+func (alloc GenesisAlloc) Transactions() []*Transaction {
+	addrs := make([]types.Address, 0, len(alloc))
+	for addr := range alloc {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return string(addrs[i].ToSlice()) < string(addrs[j].ToSlice())
+	})
+
+	txs := make([]*Transaction, len(addrs))
+	for i, addr := range addrs {
+		txs[i] = &Transaction{
+			To:    addr,
+			Value: alloc[addr],
+		}
+	}
+
+	return txs
+}
+
+// NewGenesisBlock returns a genesis block minting alloc, with the data hash
+// and state root filled in.
+func NewGenesisBlock(h *Header, alloc GenesisAlloc) (*Block, error) {
+	txs := alloc.Transactions()
+	for _, tx := range txs {
+		tx.ChainID = h.ChainID
+	}
+
+	state := NewState()
+	for _, tx := range txs {
+		if err := state.AddBalance(tx.To, tx.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	dataHash, err := CalculateDataHash(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	h.DataHash = dataHash
+	h.StateRoot = state.Root()
+
+	return NewBlock(h, txs)
+}
+
+func accountKey(addr types.Address) string {
+	return namespacedKey(accountNamespace, addr.ToSlice())
+}
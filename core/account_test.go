@@ -0,0 +1,161 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/dbkbali/bcbasic/types"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenesisAlloc(t *testing.T) {
+	alice := crypto.GeneratePrivateKey()
+	bc := newBlockchainWithAlloc(t, GenesisAlloc{alice.PublicKey().Address(): 1000})
+
+	acc, err := bc.GetAccount(alice.PublicKey().Address())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000), acc.Balance)
+
+	acc, err = bc.GetAccount(crypto.GeneratePrivateKey().PublicKey().Address())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), acc.Balance)
+}
+
+func TestTransfer(t *testing.T) {
+	var (
+		alice = crypto.GeneratePrivateKey()
+		bob   = crypto.GeneratePrivateKey().PublicKey().Address()
+		bc    = newBlockchainWithAlloc(t, GenesisAlloc{alice.PublicKey().Address(): 1000})
+	)
+
+	tx := NewTransferTransaction(bob, 300)
+	assert.Nil(t, tx.Sign(alice))
+	addBlockWithTxs(t, bc, tx)
+
+	acc, err := bc.GetAccount(alice.PublicKey().Address())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(700), acc.Balance)
+
+	acc, err = bc.GetAccount(bob)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(300), acc.Balance)
+}
+
+func TestTransferOverdraftRejected(t *testing.T) {
+	var (
+		alice = crypto.GeneratePrivateKey()
+		bob   = crypto.GeneratePrivateKey().PublicKey().Address()
+		bc    = newBlockchainWithAlloc(t, GenesisAlloc{alice.PublicKey().Address(): 100})
+	)
+
+	ok := NewTransferTransaction(bob, 60)
+	assert.Nil(t, ok.Sign(alice))
+	overdraft := NewTransferTransaction(bob, 60)
+	overdraft.Nonce = 1
+	assert.Nil(t, overdraft.Sign(alice))
+
+	genesis, err := bc.GetBlock(0)
+	assert.Nil(t, err)
+
+	// the block builder drops the overdraft
+	included, _, err := bc.PrepareBlock(genesis.Hash(BlockHasher{}), []*Transaction{ok, overdraft})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Transaction{ok}, included)
+
+	// a block containing it is rejected as a whole
+	b := newBlockWithTxs(t, 1, genesis.Hash(BlockHasher{}), ok, overdraft)
+	assert.ErrorIs(t, bc.AddBlock(b), ErrInsufficientBalance)
+	assert.Equal(t, uint32(0), bc.Height())
+
+	acc, err := bc.GetAccount(alice.PublicKey().Address())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(100), acc.Balance)
+
+	acc, err = bc.GetAccount(bob)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), acc.Balance)
+}
+
+func TestTransferSignatureCoversValue(t *testing.T) {
+	tx := NewTransferTransaction(types.Address{0x01}, 10)
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, tx.Verify())
+
+	tx.Value = 1000
+	assert.NotNil(t, tx.Verify())
+
+	tx.Value = 10
+	tx.To = types.Address{0x02}
+	assert.NotNil(t, tx.Verify())
+}
+
+func TestContractCanNotWriteAccounts(t *testing.T) {
+	s := NewState()
+	addr := types.Address{0x01}
+	assert.Nil(t, s.AddBalance(addr, 10))
+
+	assert.Nil(t, s.Put(addr.ToSlice(), []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}))
+
+	acc, err := s.GetAccount(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), acc.Balance)
+}
+
+func TestNonceReplayRejected(t *testing.T) {
+	var (
+		alice = crypto.GeneratePrivateKey()
+		bc    = newBlockchainWithAlloc(t, nil)
+	)
+
+	tx := NewTransaction([]byte("foo"))
+	assert.Nil(t, tx.Sign(alice))
+	addBlockWithTxs(t, bc, tx)
+	assert.Equal(t, uint64(1), bc.NextNonce(alice.PublicKey().Address()))
+
+	// replaying the same transaction is a stale nonce
+	prev, err := bc.GetBlock(bc.Height())
+	assert.Nil(t, err)
+	replay := newBlockWithStateRoot(t, 2, prev.Hash(BlockHasher{}), prev.StateRoot, tx)
+	assert.ErrorIs(t, bc.AddBlock(replay), ErrNonceTooLow)
+
+	gapped := NewTransaction([]byte("bar"))
+	gapped.Nonce = 2
+	assert.Nil(t, gapped.Sign(alice))
+	b := newBlockWithStateRoot(t, 2, prev.Hash(BlockHasher{}), prev.StateRoot, gapped)
+	assert.ErrorIs(t, bc.AddBlock(b), ErrNonceTooHigh)
+
+	assert.Equal(t, uint32(1), bc.Height())
+}
+
+func TestNonceCoveredBySignature(t *testing.T) {
+	tx := NewTransaction([]byte("foo"))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+
+	tx.Nonce = 1
+	assert.NotNil(t, tx.Verify())
+}
+
+func newBlockchainWithAlloc(t *testing.T, alloc GenesisAlloc) *Blockchain {
+	genesis, err := NewGenesisBlock(&Header{Version: 1}, alloc)
+	assert.Nil(t, err)
+
+	bc, err := NewBlockchain(log.NewNopLogger(), genesis)
+	assert.Nil(t, err)
+
+	return bc
+}
+
+func addBlockWithTxs(t *testing.T, bc *Blockchain, txs ...*Transaction) *Block {
+	prev, err := bc.GetBlock(bc.Height())
+	assert.Nil(t, err)
+
+	included, root, err := bc.PrepareBlock(prev.Hash(BlockHasher{}), txs)
+	assert.Nil(t, err)
+	assert.Equal(t, len(txs), len(included))
+
+	b := newBlockWithStateRoot(t, prev.Height+1, prev.Hash(BlockHasher{}), root, txs...)
+	assert.Nil(t, bc.AddBlock(b))
+
+	return b
+}
@@ -0,0 +1,463 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/dbkbali/bcbasic/types"
+)
+
+// The binary encoding is the canonical encoding of consensus data. Every
+// structure starts with the encoding version, integers are big endian and
+// variable length fields are prefixed with their length as a uint32.
+//
+//	header:      version u8 | Version u32 | ChainID u64 | DataHash [32] |
+//	             PrevBlockHash [32] | StateRoot [32] | Timestamp i64 |
+//	             Height u32 | Nonce u64
+//	transaction: version u8 | ChainID u64 | Data bytes | To [20] | Value u64 |
+//	             Nonce u64 | multisig | From bytes | signature |
+//	             multisig signature count u32 | (key index u32 | signature)...
+//	block:       version u8 | header | tx count u32 | transaction... |
+//	             Validator bytes | signature
+//	blocks:      block count u32 | block...
+//	signature:   0x00 when absent, else scheme u8 | R bytes | S bytes
+//	multisig:    0x00 when absent, else 0x01 | Threshold u32 | key count u32 |
+//	             key bytes...
+const binaryEncodingVersion byte = 3
+
+// maxBinaryFieldSize bounds the length of a single variable length field so
+// a corrupt length prefix can not make the decoder allocate without bound.
+const maxBinaryFieldSize = 1 << 24
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported encoding version")
+	ErrTrailingData        = errors.New("trailing data after encoding")
+)
+
+type BinaryHeaderEncoder struct {
+	w io.Writer
+}
+
+func NewBinaryHeaderEncoder(w io.Writer) *BinaryHeaderEncoder {
+	return &BinaryHeaderEncoder{w: w}
+}
+
+func (e *BinaryHeaderEncoder) Encode(h *Header) error {
+	bw := &binaryWriter{w: e.w}
+	bw.header(h)
+
+	return bw.err
+}
+
+type BinaryHeaderDecoder struct {
+	r io.Reader
+}
+
+func NewBinaryHeaderDecoder(r io.Reader) *BinaryHeaderDecoder {
+	return &BinaryHeaderDecoder{r: r}
+}
+
+// Decode reads one header, which must be all that is left in the reader.
+func (d *BinaryHeaderDecoder) Decode(h *Header) error {
+	br := &binaryReader{r: d.r}
+	br.header(h)
+	br.end()
+
+	return br.err
+}
+
+type BinaryTxEncoder struct {
+	w io.Writer
+}
+
+func NewBinaryTxEncoder(w io.Writer) *BinaryTxEncoder {
+	return &BinaryTxEncoder{w: w}
+}
+
+func (e *BinaryTxEncoder) Encode(tx *Transaction) error {
+	bw := &binaryWriter{w: e.w}
+	bw.transaction(tx)
+
+	return bw.err
+}
+
+type BinaryTxDecoder struct {
+	r io.Reader
+}
+
+func NewBinaryTxDecoder(r io.Reader) *BinaryTxDecoder {
+	return &BinaryTxDecoder{r: r}
+}
+
+// Decode reads one transaction, which must be all that is left in the reader.
+func (d *BinaryTxDecoder) Decode(tx *Transaction) error {
+	br := &binaryReader{r: d.r}
+	br.transaction(tx)
+	br.end()
+
+	return br.err
+}
+
+type BinaryBlockEncoder struct {
+	w io.Writer
+}
+
+func NewBinaryBlockEncoder(w io.Writer) *BinaryBlockEncoder {
+	return &BinaryBlockEncoder{w: w}
+}
+
+func (e *BinaryBlockEncoder) Encode(b *Block) error {
+	bw := &binaryWriter{w: e.w}
+	bw.block(b)
+
+	return bw.err
+}
+
+type BinaryBlockDecoder struct {
+	r io.Reader
+}
+
+func NewBinaryBlockDecoder(r io.Reader) *BinaryBlockDecoder {
+	return &BinaryBlockDecoder{r: r}
+}
+
+// Decode reads one block, which must be all that is left in the reader.
+func (d *BinaryBlockDecoder) Decode(b *Block) error {
+	br := &binaryReader{r: d.r}
+	br.block(b)
+	br.end()
+
+	return br.err
+}
+
+type BinaryBlocksEncoder struct {
+	w io.Writer
+}
+
+func NewBinaryBlocksEncoder(w io.Writer) *BinaryBlocksEncoder {
+	return &BinaryBlocksEncoder{w: w}
+}
+
+func (e *BinaryBlocksEncoder) Encode(blocks []*Block) error {
+	bw := &binaryWriter{w: e.w}
+	bw.write(uint32(len(blocks)))
+	for _, b := range blocks {
+		bw.block(b)
+	}
+
+	return bw.err
+}
+
+type BinaryBlocksDecoder struct {
+	r io.Reader
+}
+
+func NewBinaryBlocksDecoder(r io.Reader) *BinaryBlocksDecoder {
+	return &BinaryBlocksDecoder{r: r}
+}
+
+// Decode reads a list of blocks, which must be all that is left in the
+// reader.
+func (d *BinaryBlocksDecoder) Decode(blocks *[]*Block) error {
+	br := &binaryReader{r: d.r}
+
+	var count uint32
+	br.read(&count)
+	*blocks = nil
+	for i := uint32(0); i < count && br.err == nil; i++ {
+		b := new(Block)
+		br.block(b)
+		*blocks = append(*blocks, b)
+	}
+	br.end()
+
+	return br.err
+}
+
+// binaryWriter writes the binary encoding. The first error is kept and
+// every later write is skipped.
+// countingWriter counts the bytes written to it and drops them.
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// encodedSize returns the length of the binary encoding of tx.
+func (tx *Transaction) encodedSize() int {
+	w := &countingWriter{}
+	bw := &binaryWriter{w: w}
+	bw.transaction(tx)
+
+	return w.n
+}
+
+// encodedSize returns the length of the binary encoding of b.
+func (b *Block) encodedSize() int {
+	w := &countingWriter{}
+	bw := &binaryWriter{w: w}
+	bw.block(b)
+
+	return w.n
+}
+
+type binaryWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (bw *binaryWriter) write(v any) {
+	if bw.err == nil {
+		bw.err = binary.Write(bw.w, binary.BigEndian, v)
+	}
+}
+
+func (bw *binaryWriter) bytes(b []byte) {
+	bw.write(uint32(len(b)))
+	bw.write(b)
+}
+
+func (bw *binaryWriter) header(h *Header) {
+	bw.write(binaryEncodingVersion)
+	bw.write(h.Version)
+	bw.write(h.ChainID)
+	bw.write(h.DataHash)
+	bw.write(h.PrevBlockHash)
+	bw.write(h.StateRoot)
+	bw.write(h.Timestamp)
+	bw.write(h.Height)
+	bw.write(h.Nonce)
+}
+
+// txFields writes the fields of the transaction covered by its signature.
+func (bw *binaryWriter) txFields(tx *Transaction) {
+	bw.write(binaryEncodingVersion)
+	bw.write(tx.ChainID)
+	bw.bytes(tx.Data)
+	bw.write(tx.To)
+	bw.write(tx.Value)
+	bw.write(tx.Nonce)
+	bw.multisig(tx.Multisig)
+}
+
+func (bw *binaryWriter) transaction(tx *Transaction) {
+	bw.txFields(tx)
+	bw.bytes(tx.From)
+	bw.signatures(tx)
+}
+
+// signatures writes the signatures of the transaction, which its hash does not
+// cover.
+func (bw *binaryWriter) signatures(tx *Transaction) {
+	bw.signature(tx.Signature)
+	bw.write(uint32(len(tx.MultisigSignatures)))
+	for _, sig := range tx.MultisigSignatures {
+		bw.write(sig.KeyIndex)
+		bw.signature(sig.Signature)
+	}
+}
+
+func (bw *binaryWriter) multisig(m *MultisigAccount) {
+	if m == nil {
+		bw.write(byte(0))
+		return
+	}
+
+	bw.write(byte(1))
+	bw.write(m.Threshold)
+	bw.write(uint32(len(m.Keys)))
+	for _, key := range m.Keys {
+		bw.bytes(key)
+	}
+}
+
+func (bw *binaryWriter) block(b *Block) {
+	bw.write(binaryEncodingVersion)
+	bw.header(b.Header)
+	bw.write(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		bw.transaction(tx)
+	}
+	bw.bytes(b.Validator)
+	bw.signature(b.Signature)
+}
+
+func (bw *binaryWriter) signature(sig *crypto.Signature) {
+	if sig == nil {
+		bw.write(byte(0))
+		return
+	}
+
+	if sig.Scheme == 0 {
+		bw.err = fmt.Errorf("signature without scheme")
+		return
+	}
+
+	bw.write(byte(sig.Scheme))
+	bw.bytes(sig.R.Bytes())
+	bw.bytes(sig.S.Bytes())
+}
+
+// binaryReader reads the binary encoding. The first error is kept and every
+// later read is skipped.
+type binaryReader struct {
+	r   io.Reader
+	err error
+}
+
+func (br *binaryReader) read(v any) {
+	if br.err == nil {
+		br.err = binary.Read(br.r, binary.BigEndian, v)
+	}
+}
+
+func (br *binaryReader) bytes() []byte {
+	var n uint32
+	br.read(&n)
+	if br.err != nil {
+		return nil
+	}
+	if n > maxBinaryFieldSize {
+		br.err = fmt.Errorf("field of %d bytes exceeds the maximum of %d", n, maxBinaryFieldSize)
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br.r, b); err != nil {
+		br.err = err
+		return nil
+	}
+
+	return b
+}
+
+// end fails unless the reader is exhausted, so every encoding has exactly one
+// valid byte sequence.
+func (br *binaryReader) end() {
+	if br.err != nil {
+		return
+	}
+
+	var b [1]byte
+	switch _, err := io.ReadFull(br.r, b[:]); err {
+	case nil:
+		br.err = ErrTrailingData
+	case io.EOF:
+	default:
+		br.err = err
+	}
+}
+
+func (br *binaryReader) version() {
+	var version byte
+	br.read(&version)
+	if br.err == nil && version != binaryEncodingVersion {
+		br.err = fmt.Errorf("%w: %d", ErrUnsupportedEncoding, version)
+	}
+}
+
+func (br *binaryReader) header(h *Header) {
+	br.version()
+	br.read(&h.Version)
+	br.read(&h.ChainID)
+	br.read(&h.DataHash)
+	br.read(&h.PrevBlockHash)
+	br.read(&h.StateRoot)
+	br.read(&h.Timestamp)
+	br.read(&h.Height)
+	br.read(&h.Nonce)
+}
+
+func (br *binaryReader) transaction(tx *Transaction) {
+	tx.hash = types.Hash{}
+	br.version()
+	br.read(&tx.ChainID)
+	tx.Data = br.bytes()
+	br.read(&tx.To)
+	br.read(&tx.Value)
+	br.read(&tx.Nonce)
+	tx.Multisig = br.multisig()
+	tx.From = br.bytes()
+	tx.Signature = br.signature()
+
+	var count uint32
+	br.read(&count)
+	if count > maxMultisigKeys {
+		br.err = fmt.Errorf("%d multisig signatures exceed the maximum of %d", count, maxMultisigKeys)
+		return
+	}
+	tx.MultisigSignatures = nil
+	for i := uint32(0); i < count && br.err == nil; i++ {
+		sig := new(MultisigSignature)
+		br.read(&sig.KeyIndex)
+		sig.Signature = br.signature()
+		tx.MultisigSignatures = append(tx.MultisigSignatures, sig)
+	}
+}
+
+func (br *binaryReader) multisig() *MultisigAccount {
+	var present byte
+	br.read(&present)
+	if br.err != nil || present == 0 {
+		return nil
+	}
+
+	m := new(MultisigAccount)
+	br.read(&m.Threshold)
+
+	var count uint32
+	br.read(&count)
+	if count > maxMultisigKeys {
+		br.err = fmt.Errorf("%d multisig keys exceed the maximum of %d", count, maxMultisigKeys)
+		return nil
+	}
+	for i := uint32(0); i < count && br.err == nil; i++ {
+		m.Keys = append(m.Keys, br.bytes())
+	}
+
+	return m
+}
+
+func (br *binaryReader) block(b *Block) {
+	br.version()
+
+	b.Header = new(Header)
+	br.header(b.Header)
+
+	var count uint32
+	br.read(&count)
+	b.Transactions = nil
+	for i := uint32(0); i < count && br.err == nil; i++ {
+		tx := new(Transaction)
+		br.transaction(tx)
+		b.Transactions = append(b.Transactions, tx)
+	}
+
+	b.Validator = br.bytes()
+	b.Signature = br.signature()
+}
+
+func (br *binaryReader) signature() *crypto.Signature {
+	var scheme crypto.Scheme
+	br.read(&scheme)
+	if br.err != nil || scheme == 0 {
+		return nil
+	}
+
+	r, s := br.bytes(), br.bytes()
+	return &crypto.Signature{
+		Scheme: scheme,
+		R:      new(big.Int).SetBytes(r),
+		S:      new(big.Int).SetBytes(s),
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/dbkbali/bcbasic/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	goldenHeaderHex = "03" + // encoding version
+		"00000001" + // Version
+		"0000000000000009" + // ChainID
+		"0101010101010101010101010101010101010101010101010101010101010101" + // DataHash
+		"0202020202020202020202020202020202020202020202020202020202020202" + // PrevBlockHash
+		"0303030303030303030303030303030303030303030303030303030303030303" + // StateRoot
+		"000000006553f100" + // Timestamp
+		"00000007" + // Height
+		"000000000000002a" // Nonce
+	goldenHeaderHash = "ac82107e94fa28dd84f9de6c993882a65b389b7ef1b8d17aed3913739df73396"
+
+	goldenTxHex = "03" + // encoding version
+		"0000000000000009" + // ChainID
+		"00000003" + "666f6f" + // Data
+		"0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a" + // To
+		"0000000000000005" + // Value
+		"0000000000000003" + // Nonce
+		"00" + // no Multisig
+		"00000003" + "02aabb" + // From
+		"01" + "00000001" + "01" + "00000001" + "02" + // P-256 Signature
+		"00000000" // no MultisigSignatures
+	goldenTxHash = "69ff03afaf3f74a53fbb5e361a978e9a8c02c5aa658321da02e89c87e7c664c4"
+
+	goldenBlockHex = "03" + // encoding version
+		goldenHeaderHex +
+		"00000001" + goldenTxHex + // Transactions
+		"00000002" + "03cc" + // Validator
+		"00" // no Signature
+)
+
+func goldenHeader() *Header {
+	return &Header{
+		Version:       1,
+		ChainID:       9,
+		DataHash:      hashOf(0x01),
+		PrevBlockHash: hashOf(0x02),
+		StateRoot:     hashOf(0x03),
+		Timestamp:     1700000000,
+		Height:        7,
+		Nonce:         42,
+	}
+}
+
+func goldenTx() *Transaction {
+	to := types.Address{}
+	for i := range to {
+		to[i] = 0x0a
+	}
+
+	return &Transaction{
+		Data:      []byte("foo"),
+		To:        to,
+		Value:     5,
+		Nonce:     3,
+		ChainID:   9,
+		From:      crypto.PublicKey{0x02, 0xaa, 0xbb},
+		Signature: &crypto.Signature{Scheme: crypto.SchemeP256, R: big.NewInt(1), S: big.NewInt(2)},
+	}
+}
+
+func goldenBlock() *Block {
+	return &Block{
+		Header:       goldenHeader(),
+		Transactions: []*Transaction{goldenTx()},
+		Validator:    crypto.PublicKey{0x03, 0xcc},
+	}
+}
+
+func TestBinaryHeaderGolden(t *testing.T) {
+	h := goldenHeader()
+	assert.Equal(t, goldenHeaderHex, hex.EncodeToString(h.Bytes()))
+	assert.Equal(t, goldenHeaderHash, BlockHasher{}.Hash(h).String())
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, h.Encode(NewBinaryHeaderEncoder(buf)))
+	assert.Equal(t, goldenHeaderHex, hex.EncodeToString(buf.Bytes()))
+
+	decoded := new(Header)
+	assert.Nil(t, decoded.Decode(NewBinaryHeaderDecoder(buf)))
+	assert.Equal(t, h, decoded)
+}
+
+func TestBinaryTxGolden(t *testing.T) {
+	tx := goldenTx()
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, tx.Encode(NewBinaryTxEncoder(buf)))
+	assert.Equal(t, goldenTxHex, hex.EncodeToString(buf.Bytes()))
+	assert.Equal(t, goldenTxHash, tx.Hash(TxHasher{}).String())
+
+	decoded := new(Transaction)
+	assert.Nil(t, decoded.Decode(NewBinaryTxDecoder(buf)))
+	decoded.Hash(TxHasher{})
+	assert.Equal(t, tx, decoded)
+}
+
+func TestBinaryBlockGolden(t *testing.T) {
+	b := goldenBlock()
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, b.Encode(NewBinaryBlockEncoder(buf)))
+	assert.Equal(t, goldenBlockHex, hex.EncodeToString(buf.Bytes()))
+
+	decoded := new(Block)
+	assert.Nil(t, decoded.Decode(NewBinaryBlockDecoder(buf)))
+	assert.Equal(t, b, decoded)
+}
+
+func TestBinaryBlockEncodeDecode(t *testing.T) {
+	b := randomBlock(t, 1, types.Hash{})
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, b.Encode(NewBinaryBlockEncoder(buf)))
+
+	decoded := new(Block)
+	assert.Nil(t, decoded.Decode(NewBinaryBlockDecoder(buf)))
+	assert.Equal(t, b.Hash(BlockHasher{}), decoded.Hash(BlockHasher{}))
+	assert.Nil(t, decoded.Verify())
+}
+
+func TestBinaryBlocksEncodeDecode(t *testing.T) {
+	blocks := []*Block{randomBlock(t, 1, types.Hash{}), randomBlock(t, 2, types.Hash{})}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, NewBinaryBlocksEncoder(buf).Encode(blocks))
+
+	decoded := []*Block{}
+	assert.Nil(t, NewBinaryBlocksDecoder(buf).Decode(&decoded))
+	assert.Len(t, decoded, 2)
+	for i, b := range blocks {
+		assert.Equal(t, b.Hash(BlockHasher{}), decoded[i].Hash(BlockHasher{}))
+	}
+
+	buf.Reset()
+	assert.Nil(t, NewBinaryBlocksEncoder(buf).Encode(nil))
+	assert.Nil(t, NewBinaryBlocksDecoder(buf).Decode(&decoded))
+	assert.Empty(t, decoded)
+}
+
+func TestBinaryDecodeRejectsTrailingData(t *testing.T) {
+	b := randomBlock(t, 1, types.Hash{})
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, b.Encode(NewBinaryBlockEncoder(buf)))
+	buf.WriteByte(0x00)
+	assert.ErrorIs(t, new(Block).Decode(NewBinaryBlockDecoder(buf)), ErrTrailingData)
+
+	buf.Reset()
+	tx := b.Transactions[0]
+	assert.Nil(t, tx.Encode(NewBinaryTxEncoder(buf)))
+	buf.WriteByte(0x00)
+	assert.ErrorIs(t, new(Transaction).Decode(NewBinaryTxDecoder(buf)), ErrTrailingData)
+
+	buf.Reset()
+	assert.Nil(t, b.Header.Encode(NewBinaryHeaderEncoder(buf)))
+	buf.WriteByte(0x00)
+	assert.ErrorIs(t, new(Header).Decode(NewBinaryHeaderDecoder(buf)), ErrTrailingData)
+}
+
+func TestBinaryDecodeRejectsUnknownVersion(t *testing.T) {
+	data, _ := hex.DecodeString("01" + strings.Repeat("00", 128))
+
+	err := new(Header).Decode(NewBinaryHeaderDecoder(bytes.NewReader(data)))
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+func TestBinaryDecodeRejectsOversizedField(t *testing.T) {
+	data, _ := hex.DecodeString("03" + "0000000000000000" + "ffffffff")
+
+	assert.NotNil(t, new(Transaction).Decode(NewBinaryTxDecoder(bytes.NewReader(data))))
+}
+
+func hashOf(b byte) types.Hash {
+	h := types.Hash{}
+	for i := range h {
+		h[i] = b
+	}
+
+	return h
+}
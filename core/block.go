@@ -2,8 +2,6 @@ package core
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/gob"
 	"fmt"
 	"time"
 
@@ -12,22 +10,37 @@ import (
 )
 
 type Header struct {
-	Version       uint32
+	Version uint32
+	// ChainID identifies the network, it is set in the genesis header and
+	// inherited by every block.
+	ChainID       uint64
 	DataHash      types.Hash
 	PrevBlockHash types.Hash
-	Timestamp     int64
-	Height        uint32
-	Nonce         uint64
+	// StateRoot commits to the state after executing the block's transactions
+	StateRoot types.Hash
+	Timestamp int64
+	Height    uint32
+	Nonce     uint64
 }
 
+// Bytes returns the canonical binary encoding of the header, which is what
+// the block hash commits to.
 func (h *Header) Bytes() []byte {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	enc.Encode(h)
+	buf := &bytes.Buffer{}
+	bw := &binaryWriter{w: buf}
+	bw.header(h)
 
 	return buf.Bytes()
 }
 
+func (h *Header) Decode(dec Decoder[*Header]) error {
+	return dec.Decode(h)
+}
+
+func (h *Header) Encode(enc Encoder[*Header]) error {
+	return enc.Encode(h)
+}
+
 type Block struct {
 	*Header
 
@@ -54,6 +67,7 @@ func NewBlockFromPrevHeader(prevHeader *Header, txx []*Transaction) (*Block, err
 
 	header := &Header{
 		Version:       1,
+		ChainID:       prevHeader.ChainID,
 		Height:        prevHeader.Height + 1,
 		DataHash:      dataHash,
 		PrevBlockHash: BlockHasher{}.Hash(prevHeader),
@@ -67,41 +81,58 @@ func (b *Block) AddTransaction(tx *Transaction) {
 	b.Transactions = append(b.Transactions, tx)
 }
 
-func (b *Block) Sign(pk crypto.PrivateKey) error {
-	sig, err := pk.Sign(b.Header.Bytes())
+// Sign signs the encoded header, which commits to the whole block, tagged
+// with the block domain and the chain ID.
+func (b *Block) Sign(signer crypto.Signer) error {
+	sig, err := signer.Sign(b.signingBytes())
 	if err != nil {
 		return err
 	}
 
-	b.Validator = pk.PublicKey()
+	b.Validator = signer.PublicKey()
 	b.Signature = sig
 
 	return nil
 }
 
 func (b *Block) Verify() error {
+	return b.VerifyCached(nil)
+}
+
+// VerifyCached is Verify with the transaction signatures checked in parallel,
+// skipping the ones found in cache.
+func (b *Block) VerifyCached(cache *SigCache) error {
 	if b.Signature == nil {
 		return fmt.Errorf("no signature")
 	}
 
-	if !b.Signature.Verify(b.Validator, b.Header.Bytes()) {
+	if !b.Signature.Verify(b.Validator, b.signingBytes()) {
 		return fmt.Errorf("invalid signature")
 	}
 
 	for _, tx := range b.Transactions {
-		if err := tx.Verify(); err != nil {
-			return err
+		if tx.ChainID != b.ChainID {
+			return fmt.Errorf("%w: tx [%s] chain id [%d] in block of chain [%d]", ErrChainIDMismatch, tx.Hash(TxHasher{}), tx.ChainID, b.ChainID)
 		}
 	}
 
-	hash, _ := CalculateDataHash(b.Transactions)
-	if hash != b.DataHash {
+	if err := VerifyTransactions(b.Transactions, cache); err != nil {
+		return err
+	}
+
+	dataHash, _ := CalculateDataHash(b.Transactions)
+	if dataHash != b.DataHash {
 		return fmt.Errorf("block [%s] data hash mismatch", b.Hash(BlockHasher{}))
 	}
 
 	return nil
 }
 
+// signingBytes returns the message the validator signs.
+func (b *Block) signingBytes() []byte {
+	return signingMessage(blockSigningTag, b.ChainID, b.Header.Bytes())
+}
+
 func (b *Block) Decode(dec Decoder[*Block]) error {
 	return dec.Decode(b)
 }
@@ -118,16 +149,28 @@ func (b *Block) Hash(hasher Hasher[*Header]) types.Hash {
 	return b.hash
 }
 
+// TxProof returns the merkle proof that the transaction at index is included
+// in the block's DataHash.
+func (b *Block) TxProof(index int) (*MerkleProof, error) {
+	return NewMerkleProof(txHashes(b.Transactions), index)
+}
+
+// VerifyTxInclusion reports whether proof shows that tx is included in the
+// block with the given header.
+func VerifyTxInclusion(h *Header, tx *Transaction, proof *MerkleProof) bool {
+	return proof.Verify(h.DataHash, tx.Hash(TxHasher{}))
+}
+
+// CalculateDataHash returns the merkle root of the transaction hashes.
 func CalculateDataHash(txs []*Transaction) (hash types.Hash, err error) {
-	buf := &bytes.Buffer{}
+	return MerkleRoot(txHashes(txs)), nil
+}
 
-	for _, tx := range txs {
-		if err = tx.Encode(NewGobTxEncoder(buf)); err != nil {
-			return
-		}
+func txHashes(txs []*Transaction) []types.Hash {
+	hashes := make([]types.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash(TxHasher{})
 	}
 
-	hash = sha256.Sum256((buf.Bytes()))
-
-	return
+	return hashes
 }
@@ -18,6 +18,10 @@ func TestSignBLock(t *testing.T) {
 	assert.Nil(t, b.Sign(privKey))
 	assert.NotNil(t, b.Signature)
 
+	// signing is deterministic
+	sig := b.Signature
+	assert.Nil(t, b.Sign(privKey))
+	assert.Equal(t, sig, b.Signature)
 }
 
 func TestVerifyBLock(t *testing.T) {
@@ -36,6 +40,16 @@ func TestVerifyBLock(t *testing.T) {
 	assert.NotNil(t, b.Verify())
 }
 
+func TestBlockSignedWithEd25519(t *testing.T) {
+	b := randomBlock(t, 0, types.Hash{})
+
+	assert.Nil(t, b.Sign(crypto.GenerateEd25519PrivateKey()))
+	assert.Nil(t, b.Verify())
+
+	b.Height = 100
+	assert.NotNil(t, b.Verify())
+}
+
 func TestBlockEncodeDecode(t *testing.T) {
 	b := randomBlock(t, 1, types.Hash{})
 	buf := &bytes.Buffer{}
@@ -43,6 +57,10 @@ func TestBlockEncodeDecode(t *testing.T) {
 
 	bDecode := new(Block)
 	assert.Nil(t, bDecode.Decode(NewGobBlockDecoder(buf)))
+	// the tx hashes are cached on the original only
+	for _, tx := range bDecode.Transactions {
+		tx.Hash(TxHasher{})
+	}
 	assert.Equal(t, b, bDecode)
 
 }
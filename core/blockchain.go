@@ -1,32 +1,86 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
+	"github.com/dbkbali/bcbasic/types"
 	"github.com/go-kit/log"
 )
 
+var (
+	ErrUnknownHash = errors.New("unknown block hash")
+	ErrUnknownTx   = errors.New("unknown transaction")
+	ErrChainHalted = errors.New("chain halted")
+)
+
+// ReorgEvent is emitted when the canonical chain switches to another branch.
+type ReorgEvent struct {
+	OldTip         types.Hash
+	NewTip         types.Hash
+	CommonAncestor types.Hash
+	// blocks removed from the canonical chain, from the old tip downwards
+	Disconnected []*Block
+	// blocks added to the canonical chain, from the common ancestor upwards
+	Connected []*Block
+}
+
 type Blockchain struct {
-	logger    log.Logger
-	store     Storage
+	logger log.Logger
+	store  Storage
+	// writeLock serialises modifications of the block tree and the state
+	writeLock sync.Mutex
 	lock      sync.RWMutex
-	headers   []*Header
-	blocks    []*Block
-	validator Validator
-	// TODO: convert to interface
-	contractState *State
+	// headers and blocks of the canonical chain
+	headers []*Header
+	blocks  []*Block
+	// index of every known block by its hash, including side branches
+	blockIndex map[types.Hash]*blockNode
+	// transactions of the canonical chain by their hash
+	txIndex    map[types.Hash]*Transaction
+	tip        *blockNode
+	forkChoice ForkChoiceRule
+	validator  Validator
+	// transactions whose signatures verified
+	sigCache  *SigCache
+	reorgSubs []chan ReorgEvent
+	// contract storage and accounts of the canonical chain
+	state *State
+	// set when a failed reorganisation could not restore the old branch,
+	// the chain refuses every further change once it is set
+	halted error
 }
 
 func NewBlockchain(l log.Logger, genesis *Block) (*Blockchain, error) {
+	return NewBlockchainWithStorage(l, NewMemoryStore(), genesis)
+}
+
+// NewBlockchainWithStorage creates a blockchain backed by store. If the store
+// already holds blocks the chain is loaded from it, otherwise it is
+// initialised with genesis.
+func NewBlockchainWithStorage(l log.Logger, store Storage, genesis *Block) (*Blockchain, error) {
 	bc := &Blockchain{
-		contractState: NewState(),
-		headers:       []*Header{},
-		store:         NewMemoryStore(),
-		logger:        l,
+		state:      NewState(),
+		headers:    []*Header{},
+		blockIndex: make(map[types.Hash]*blockNode),
+		txIndex:    make(map[types.Hash]*Transaction),
+		sigCache:   NewSigCache(defaultSigCacheSize),
+		forkChoice: LongestChainRule{},
+		store:      store,
+		logger:     l,
 	}
 	bc.validator = NewBlockValidator(bc)
-	err := bc.addBlockWithoutValidation(genesis)
+
+	loaded, err := bc.loadFromStore(genesis)
+	if err != nil {
+		return nil, err
+	}
+	if loaded {
+		return bc, nil
+	}
+
+	err = bc.addBlockWithoutValidation(genesis)
 
 	return bc, err
 }
@@ -35,68 +89,559 @@ func (bc *Blockchain) SetValidator(v Validator) {
 	bc.validator = v
 }
 
+// SetForkChoice changes the rule used to pick the canonical chain. The score
+// of every known block is recomputed and the chain is reorganised if another
+// branch is now preferred.
+func (bc *Blockchain) SetForkChoice(rule ForkChoiceRule) error {
+	bc.writeLock.Lock()
+	defer bc.writeLock.Unlock()
+
+	if bc.halted != nil {
+		return bc.halted
+	}
+
+	bc.lock.Lock()
+	bc.forkChoice = rule
+
+	// rescore parents before their children
+	nodes := make([]*blockNode, 0, len(bc.blockIndex))
+	for _, node := range bc.blockIndex {
+		nodes = append(nodes, node)
+	}
+	sortNodesByHeight(nodes)
+
+	best := bc.tip
+	for _, node := range nodes {
+		node.updateScore(rule)
+	}
+	for _, node := range nodes {
+		if !node.hasInvalidAncestor() && node.betterThan(best) {
+			best = node
+		}
+	}
+	bc.lock.Unlock()
+
+	if best == bc.tip {
+		return nil
+	}
+
+	return bc.reorganise(best)
+}
+
+// PrepareBlock executes txs on top of the current tip and returns the ones
+// that succeeded, in order, together with the resulting state root. Failing
+// transactions and the ones that do not fit into MaxBlockSize are skipped and
+// the state is left unchanged. parent must be the
+// hash of the tip, so the result is only handed out for a block that will
+// extend the canonical chain.
+func (bc *Blockchain) PrepareBlock(parent types.Hash, txs []*Transaction) ([]*Transaction, types.Hash, error) {
+	bc.writeLock.Lock()
+	defer bc.writeLock.Unlock()
+
+	if bc.halted != nil {
+		return nil, types.Hash{}, bc.halted
+	}
+	if parent != bc.tip.hash {
+		return nil, types.Hash{}, fmt.Errorf("block [%s] is not the tip of the chain", parent)
+	}
+
+	snap := bc.state.Snapshot()
+	defer bc.state.RevertToSnapshot(snap)
+
+	included := []*Transaction{}
+	size := blockOverhead
+	for _, tx := range txs {
+		txSize := tx.encodedSize()
+		if size+txSize > MaxBlockSize {
+			bc.logger.Log("msg", "skipping tx exceeding the block size", "hash", tx.Hash(TxHasher{}), "size", txSize)
+			continue
+		}
+
+		txSnap := bc.state.Snapshot()
+		if err := bc.executeTx(tx); err != nil {
+			bc.logger.Log("msg", "skipping failing tx", "hash", tx.Hash(TxHasher{}), "err", err)
+			bc.state.RevertToSnapshot(txSnap)
+			continue
+		}
+		included = append(included, tx)
+		size += txSize
+	}
+
+	return included, bc.state.Root(), nil
+}
+
+// SubscribeReorgs returns a channel on which every reorganisation of the
+// canonical chain is reported. Events are dropped if the subscriber does not
+// keep up.
+func (bc *Blockchain) SubscribeReorgs() <-chan ReorgEvent {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	ch := make(chan ReorgEvent, 16)
+	bc.reorgSubs = append(bc.reorgSubs, ch)
+
+	return ch
+}
+
+// AddBlock validates b and adds it to the block tree. If the branch it
+// extends becomes the preferred one the canonical chain is reorganised.
 func (bc *Blockchain) AddBlock(b *Block) error {
 	// validate block
 	if err := bc.validator.ValidateBlock(b); err != nil {
 		return err
 	}
 
-	for _, tx := range b.Transactions {
-		bc.logger.Log("msg", "running vm", "len", len(tx.Data), "hash", tx.Hash(TxHasher{}))
-
-		vm := NewVM(tx.Data, bc.contractState)
-		if err := vm.Run(); err != nil {
-			return err
-		}
-
-		// vmResult := vm.stack.Pop()
+	bc.writeLock.Lock()
+	defer bc.writeLock.Unlock()
 
+	if bc.halted != nil {
+		return bc.halted
 	}
 
-	return bc.addBlockWithoutValidation(b)
+	return bc.insertBlock(b, true)
 }
 
 func (bc *Blockchain) GetBlock(height uint32) (*Block, error) {
-	if height > bc.Height() {
-		return nil, fmt.Errorf("blockchain height [%d] is less than requested height [%d]", bc.Height(), height)
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	if int(height) >= len(bc.blocks) {
+		return nil, fmt.Errorf("blockchain height [%d] is less than requested height [%d]", len(bc.blocks)-1, height)
 	}
-	bc.lock.Lock()
-	defer bc.lock.Unlock()
 
 	return bc.blocks[height], nil
 }
 
 func (bc *Blockchain) GetHeader(height uint32) (*Header, error) {
-	if height > bc.Height() {
-		return nil, fmt.Errorf("blockchain height [%d] is less than requested height [%d]", bc.Height(), height)
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	if int(height) >= len(bc.headers) {
+		return nil, fmt.Errorf("blockchain height [%d] is less than requested height [%d]", len(bc.headers)-1, height)
 	}
-	bc.lock.Lock()
-	defer bc.lock.Unlock()
 
 	return bc.headers[height], nil
 }
 
+// GetBlockByHash returns any known block, including blocks on side branches.
+func (bc *Blockchain) GetBlockByHash(hash types.Hash) (*Block, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	node, ok := bc.blockIndex[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s]", ErrUnknownHash, hash)
+	}
+
+	return node.block, nil
+}
+
+func (bc *Blockchain) GetHeaderByHash(hash types.Hash) (*Header, error) {
+	block, err := bc.GetBlockByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return block.Header, nil
+}
+
+// GetTransaction returns a transaction of the canonical chain by its hash.
+func (bc *Blockchain) GetTransaction(hash types.Hash) (*Transaction, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	tx, ok := bc.txIndex[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s]", ErrUnknownTx, hash)
+	}
+
+	return tx, nil
+}
+
+// HasBlock reports whether the canonical chain has a block at height.
 func (bc *Blockchain) HasBlock(height uint32) bool {
 	return height <= bc.Height()
 }
 
+// HasBlockHash reports whether the block is known, on any branch.
+func (bc *Blockchain) HasBlockHash(hash types.Hash) bool {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	_, ok := bc.blockIndex[hash]
+	return ok
+}
+
+// IsCanonical reports whether the block is part of the canonical chain.
+func (bc *Blockchain) IsCanonical(hash types.Hash) bool {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	node, ok := bc.blockIndex[hash]
+	if !ok || int(node.height()) >= len(bc.blocks) {
+		return false
+	}
+
+	return bc.blocks[node.height()] == node.block
+}
+
+// GetAccount returns the account of addr at the tip of the canonical chain.
+func (bc *Blockchain) GetAccount(addr types.Address) (*Account, error) {
+	bc.writeLock.Lock()
+	defer bc.writeLock.Unlock()
+
+	return bc.state.GetAccount(addr)
+}
+
+// NextNonce returns the nonce the next transaction of addr must carry.
+func (bc *Blockchain) NextNonce(addr types.Address) uint64 {
+	acc, err := bc.GetAccount(addr)
+	if err != nil {
+		return 0
+	}
+
+	return acc.Nonce
+}
+
+// VerifyTransaction checks the signatures of tx and remembers the result, so
+// the transaction is not verified again when a block including it is added.
+func (bc *Blockchain) VerifyTransaction(tx *Transaction) error {
+	return verifyTransaction(tx, bc.sigCache)
+}
+
+// ChainID returns the chain ID of the genesis block.
+func (bc *Blockchain) ChainID() uint64 {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.headers[0].ChainID
+}
+
+// TipHash returns the hash of the last block of the canonical chain.
+func (bc *Blockchain) TipHash() types.Hash {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.tip.hash
+}
+
 func (bc *Blockchain) Height() uint32 {
 	bc.lock.RLock()
 	defer bc.lock.RUnlock()
 	return uint32(len(bc.headers) - 1)
 }
 
+// addBlockWithoutValidation sets the genesis block as the root of the tree.
 func (bc *Blockchain) addBlockWithoutValidation(b *Block) error {
+	node := newBlockNode(b, nil, bc.forkChoice)
+
+	if err := bc.store.Put(b); err != nil {
+		return err
+	}
+	if err := bc.connectBlock(node); err != nil {
+		return err
+	}
+
 	bc.lock.Lock()
-	bc.headers = append(bc.headers, b.Header)
-	bc.blocks = append(bc.blocks, b)
+	bc.blockIndex[node.hash] = node
+	bc.tip = node
 	bc.lock.Unlock()
 
 	bc.logger.Log(
 		"msg", "BlockAdd",
-		"hash", b.Hash(BlockHasher{}),
+		"hash", node.hash,
 		"height", b.Height,
 		"txs", len(b.Transactions),
 	)
-	return bc.store.Put(b)
+	return nil
+}
+
+// insertBlock adds a block whose parent is already known to the tree. When
+// store is set the block is persisted before it can become canonical, so the
+// stored chain never lags behind the one in memory. The caller must hold
+// writeLock.
+func (bc *Blockchain) insertBlock(b *Block, store bool) error {
+	bc.lock.RLock()
+	parent, ok := bc.blockIndex[b.PrevBlockHash]
+	_, known := bc.blockIndex[b.Hash(BlockHasher{})]
+	bc.lock.RUnlock()
+
+	if known {
+		return ErrBlockKnown
+	}
+	if !ok {
+		return fmt.Errorf("%w: [%s]", ErrUnknownParent, b.PrevBlockHash)
+	}
+	if parent.hasInvalidAncestor() {
+		return fmt.Errorf("block [%s] extends an invalid branch", b.Hash(BlockHasher{}))
+	}
+
+	if store {
+		if err := bc.store.Put(b); err != nil {
+			return err
+		}
+	}
+
+	node := newBlockNode(b, parent, bc.forkChoice)
+
+	bc.lock.Lock()
+	bc.blockIndex[node.hash] = node
+	bc.lock.Unlock()
+
+	if node.betterThan(bc.tip) {
+		if err := bc.reorganise(node); err != nil {
+			bc.lock.Lock()
+			delete(bc.blockIndex, node.hash)
+			bc.lock.Unlock()
+			return err
+		}
+	}
+
+	bc.logger.Log(
+		"msg", "BlockAdd",
+		"hash", node.hash,
+		"height", b.Height,
+		"txs", len(b.Transactions),
+		"canonical", bc.tip == node,
+	)
+
+	return nil
+}
+
+// reorganise makes the chain ending at newTip canonical. Blocks of the current
+// chain above the common ancestor are disconnected, rolling back their state
+// changes, and the blocks of the new branch are connected. If a block of the
+// new branch fails to execute the original chain is restored; if that fails
+// too the chain is halted and ErrChainHalted returned.
+func (bc *Blockchain) reorganise(newTip *blockNode) error {
+	oldTip := bc.tip
+	ancestor, detach, attach := findFork(oldTip, newTip)
+
+	for i := len(detach) - 1; i >= 0; i-- {
+		bc.disconnectBlock(detach[i])
+	}
+
+	for i, node := range attach {
+		if err := bc.connectBlock(node); err != nil {
+			node.invalid = true
+
+			for j := i - 1; j >= 0; j-- {
+				bc.disconnectBlock(attach[j])
+			}
+			for _, old := range detach {
+				if err := bc.connectBlock(old); err != nil {
+					bc.halted = fmt.Errorf("%w: failed to restore block [%s]: %s", ErrChainHalted, old.hash, err)
+					bc.logger.Log("msg", "chain halted", "err", bc.halted)
+					return bc.halted
+				}
+			}
+
+			return fmt.Errorf("block [%s] failed to execute: %w", node.hash, err)
+		}
+	}
+
+	bc.lock.Lock()
+	bc.tip = newTip
+	bc.lock.Unlock()
+
+	if len(detach) > 0 {
+		bc.emitReorg(oldTip, newTip, ancestor, detach, attach)
+	}
+
+	return nil
+}
+
+// connectBlock executes the transactions of the block against the state and
+// appends it to the canonical chain. On failure the state is left untouched.
+func (bc *Blockchain) connectBlock(node *blockNode) error {
+	snap := bc.state.Snapshot()
+
+	err := bc.executeBlock(node.block)
+	if err == nil {
+		err = bc.validator.ValidateState(node.block, bc.state)
+	}
+	if err != nil {
+		bc.state.RevertToSnapshot(snap)
+		return err
+	}
+
+	// keep the changes around to disconnect the block again during a reorg
+	undo, err := bc.state.changesSince(snap)
+	if err != nil {
+		bc.state.RevertToSnapshot(snap)
+		return err
+	}
+	node.undo = undo
+	bc.state.Commit()
+
+	bc.lock.Lock()
+	bc.headers = append(bc.headers, node.block.Header)
+	bc.blocks = append(bc.blocks, node.block)
+	for _, tx := range node.block.Transactions {
+		bc.txIndex[tx.Hash(TxHasher{})] = tx
+	}
+	bc.lock.Unlock()
+
+	return nil
+}
+
+// disconnectBlock removes the tip of the canonical chain and rolls back its
+// state changes.
+func (bc *Blockchain) disconnectBlock(node *blockNode) {
+	bc.state.undo(node.undo)
+	node.undo = nil
+
+	bc.lock.Lock()
+	bc.headers = bc.headers[:len(bc.headers)-1]
+	bc.blocks = bc.blocks[:len(bc.blocks)-1]
+	for _, tx := range node.block.Transactions {
+		delete(bc.txIndex, tx.Hash(TxHasher{}))
+	}
+	bc.lock.Unlock()
+}
+
+// executeBlock runs every transaction of the block. If one fails the changes
+// of that transaction are reverted, the changes of the transactions before it
+// are left for the caller to revert.
+func (bc *Blockchain) executeBlock(b *Block) error {
+	for _, tx := range b.Transactions {
+		snap := bc.state.Snapshot()
+
+		var err error
+		if b.Height == 0 {
+			err = bc.executeGenesisTx(tx)
+		} else {
+			err = bc.executeTx(tx)
+		}
+		if err != nil {
+			bc.state.RevertToSnapshot(snap)
+			return fmt.Errorf("tx [%s] failed: %w", tx.Hash(TxHasher{}), err)
+		}
+	}
+
+	return nil
+}
+
+// executeTx applies the transfer of the transaction, if any, and runs its
+// bytecode.
+func (bc *Blockchain) executeTx(tx *Transaction) (err error) {
+	if err := bc.state.UseNonce(tx.Sender(), tx.Nonce); err != nil {
+		return err
+	}
+
+	if tx.IsTransfer() {
+		if tx.To.IsZero() {
+			return fmt.Errorf("transfer without recipient")
+		}
+		if err := bc.state.Transfer(tx.Sender(), tx.To, tx.Value); err != nil {
+			return err
+		}
+	}
+
+	if len(tx.Data) == 0 {
+		return nil
+	}
+
+	bc.logger.Log("msg", "running vm", "len", len(tx.Data), "hash", tx.Hash(TxHasher{}))
+
+	// malformed bytecode makes the vm panic, treat it as a failed transaction
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("vm panic: %v", r)
+		}
+	}()
+
+	vm := NewVM(tx.Data, bc.state)
+	if err := vm.Run(); err != nil {
+		return err
+	}
+
+	// vmResult := vm.stack.Pop()
+
+	return nil
+}
+
+// executeGenesisTx mints the genesis allocation. Unsigned genesis
+// transactions have no sender, they credit Value to To.
+func (bc *Blockchain) executeGenesisTx(tx *Transaction) error {
+	if tx.Signature != nil {
+		return bc.executeTx(tx)
+	}
+
+	return bc.state.AddBalance(tx.To, tx.Value)
+}
+
+func (bc *Blockchain) emitReorg(oldTip, newTip, ancestor *blockNode, detach, attach []*blockNode) {
+	event := ReorgEvent{
+		OldTip:         oldTip.hash,
+		NewTip:         newTip.hash,
+		CommonAncestor: ancestor.hash,
+	}
+	for i := len(detach) - 1; i >= 0; i-- {
+		event.Disconnected = append(event.Disconnected, detach[i].block)
+	}
+	for _, node := range attach {
+		event.Connected = append(event.Connected, node.block)
+	}
+
+	bc.logger.Log(
+		"msg", "chain reorganised",
+		"old tip", oldTip.hash,
+		"new tip", newTip.hash,
+		"ancestor height", ancestor.height(),
+		"disconnected", len(event.Disconnected),
+		"connected", len(event.Connected),
+	)
+
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	for _, ch := range bc.reorgSubs {
+		select {
+		case ch <- event:
+		default:
+			bc.logger.Log("msg", "dropping reorg event, subscriber is not keeping up")
+		}
+	}
+}
+
+// loadFromStore rebuilds the block tree from the blocks already in the store,
+// re-running the transactions of the canonical chain to restore the contract
+// state. It reports false if the store is empty.
+func (bc *Blockchain) loadFromStore(genesis *Block) (bool, error) {
+	loaded := false
+
+	err := bc.store.Iterate(func(b *Block) error {
+		if !loaded {
+			if b.Hash(BlockHasher{}) != genesis.Hash(BlockHasher{}) {
+				return fmt.Errorf("stored genesis [%s] does not match genesis [%s]", b.Hash(BlockHasher{}), genesis.Hash(BlockHasher{}))
+			}
+
+			node := newBlockNode(b, nil, bc.forkChoice)
+			if err := bc.connectBlock(node); err != nil {
+				return err
+			}
+			bc.blockIndex[node.hash] = node
+			bc.tip = node
+			loaded = true
+
+			return nil
+		}
+
+		err := bc.insertBlock(b, false)
+		if err != nil && !errors.Is(err, ErrBlockKnown) {
+			bc.logger.Log("msg", "skipping stored block", "hash", b.Hash(BlockHasher{}), "err", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if loaded {
+		bc.logger.Log("msg", "loaded chain from storage", "height", bc.Height(), "blocks", len(bc.blockIndex))
+	}
+
+	return loaded, nil
 }
@@ -1,8 +1,11 @@
 package core
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/dbkbali/bcbasic/crypto"
 	"github.com/dbkbali/bcbasic/types"
 	"github.com/go-kit/log"
 	"github.com/stretchr/testify/assert"
@@ -13,7 +16,7 @@ func TestAddBlock(t *testing.T) {
 
 	lenBlocks := 100
 	for i := 0; i < lenBlocks; i++ {
-		block := randomBlock(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1)))
+		block := randomBlockOnTip(t, bc)
 		assert.Nil(t, bc.AddBlock(block))
 	}
 
@@ -40,7 +43,7 @@ func TestGetBlock(t *testing.T) {
 	lenBlocks := 100
 
 	for i := 0; i < lenBlocks; i++ {
-		block := randomBlock(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1)))
+		block := randomBlockOnTip(t, bc)
 		assert.Nil(t, bc.AddBlock(block))
 		b, err := bc.GetBlock(block.Height)
 		assert.Nil(t, err)
@@ -53,7 +56,7 @@ func TestGetHeader(t *testing.T) {
 	lenBlocks := 100
 
 	for i := 0; i < lenBlocks; i++ {
-		block := randomBlock(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1)))
+		block := randomBlockOnTip(t, bc)
 		assert.Nil(t, bc.AddBlock(block))
 		header, err := bc.GetHeader(block.Height)
 		assert.Nil(t, err)
@@ -64,19 +67,429 @@ func TestGetHeader(t *testing.T) {
 func TestAddBlockToHigh(t *testing.T) {
 	bc := newBlockchainWithGenesis(t)
 
-	assert.Nil(t, bc.AddBlock(randomBlock(t, 1, getPrevBlockHash(t, bc, uint32(1)))))
+	assert.Nil(t, bc.AddBlock(randomBlockOnTip(t, bc)))
 	assert.NotNil(t, bc.AddBlock(randomBlock(t, 3, types.Hash{})))
 }
 
+func TestAddBlockSideBranch(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	blocks := addRandomBlocks(t, bc, 3)
+
+	side := emptyBlock(t, blocks[0])
+	assert.Nil(t, bc.AddBlock(side))
+	assert.ErrorIs(t, bc.AddBlock(side), ErrBlockKnown)
+
+	// equal length branches keep the chain seen first
+	assert.Equal(t, uint32(3), bc.Height())
+	assert.True(t, bc.IsCanonical(blocks[1].Hash(BlockHasher{})))
+	assert.False(t, bc.IsCanonical(side.Hash(BlockHasher{})))
+
+	b, err := bc.GetBlockByHash(side.Hash(BlockHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, side, b)
+}
+
+func TestReorgLongestChain(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	reorgs := bc.SubscribeReorgs()
+	blocks := addRandomBlocks(t, bc, 3)
+
+	prev := blocks[0]
+	branch := []*Block{}
+	for height := uint32(2); height <= 4; height++ {
+		b := emptyBlock(t, prev)
+		assert.Nil(t, bc.AddBlock(b))
+		branch = append(branch, b)
+		prev = b
+	}
+
+	assert.Equal(t, uint32(4), bc.Height())
+	for _, b := range branch {
+		canonical, err := bc.GetBlock(b.Height)
+		assert.Nil(t, err)
+		assert.Equal(t, b, canonical)
+	}
+	assert.False(t, bc.IsCanonical(blocks[2].Hash(BlockHasher{})))
+
+	select {
+	case event := <-reorgs:
+		assert.Equal(t, blocks[2].Hash(BlockHasher{}), event.OldTip)
+		assert.Equal(t, branch[2].Hash(BlockHasher{}), event.NewTip)
+		assert.Equal(t, blocks[0].Hash(BlockHasher{}), event.CommonAncestor)
+		assert.Equal(t, []*Block{blocks[2], blocks[1]}, event.Disconnected)
+		assert.Equal(t, branch, event.Connected)
+	default:
+		t.Fatal("expected a reorg event")
+	}
+}
+
+func TestReorgRollsBackState(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	genesis, err := bc.GetBlock(0)
+	assert.Nil(t, err)
+
+	// FOO = 2 + 3
+	store := signedTx(t, []byte{0x02, 0x0a, 0x03, 0x0a, 0x0b, 0x4f, 0x0c, 0x4f, 0x0c, 0x46, 0x0c, 0x03, 0x0a, 0x0d, 0x0f})
+	_, root, err := bc.PrepareBlock(genesis.Hash(BlockHasher{}), []*Transaction{store})
+	assert.Nil(t, err)
+	a1 := newBlockWithStateRoot(t, 1, genesis.Hash(BlockHasher{}), root, store)
+	assert.Nil(t, bc.AddBlock(a1))
+
+	_, err = bc.state.Get([]byte("FOO"))
+	assert.Nil(t, err)
+
+	b1 := emptyBlock(t, genesis)
+	b2 := emptyBlock(t, b1)
+	assert.Nil(t, bc.AddBlock(b1))
+	assert.Nil(t, bc.AddBlock(b2))
+
+	assert.True(t, bc.IsCanonical(b2.Hash(BlockHasher{})))
+	_, err = bc.state.Get([]byte("FOO"))
+	assert.NotNil(t, err)
+
+	// switching back re-applies the state changes of a1
+	a2 := emptyBlock(t, a1)
+	a3 := emptyBlock(t, a2)
+	assert.Nil(t, bc.AddBlock(a2))
+	assert.Nil(t, bc.AddBlock(a3))
+
+	assert.True(t, bc.IsCanonical(a1.Hash(BlockHasher{})))
+	value, err := bc.state.Get([]byte("FOO"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), deserializeInt64(value))
+}
+
+func TestReorgToInvalidBranchRestoresChain(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	blocks := addRandomBlocks(t, bc, 2)
+
+	// reading the missing key BAR fails when the block is executed
+	failing := signedTx(t, []byte{0x52, 0x0c, 0x41, 0x0c, 0x42, 0x0c, 0x03, 0x0a, 0x0d, 0xae})
+	side1 := newBlockWithTxs(t, 1, blocks[0].PrevBlockHash, failing)
+	side2 := emptyBlock(t, side1)
+	side3 := emptyBlock(t, side2)
+
+	assert.Nil(t, bc.AddBlock(side1))
+	assert.Nil(t, bc.AddBlock(side2))
+	assert.NotNil(t, bc.AddBlock(side3))
+
+	assert.Equal(t, uint32(2), bc.Height())
+	assert.True(t, bc.IsCanonical(blocks[1].Hash(BlockHasher{})))
+	assert.False(t, bc.HasBlockHash(side3.Hash(BlockHasher{})))
+
+	// the invalid branch can not be extended any more
+	side3b := emptyBlock(t, side2)
+	side3b.Timestamp++
+	assert.NotNil(t, bc.AddBlock(side3b))
+}
+
+// restoreFailingValidator fails the state check of one block, so a reorg away
+// from it can not connect it again.
+type restoreFailingValidator struct {
+	Validator
+	fail types.Hash
+}
+
+func (v restoreFailingValidator) ValidateState(b *Block, state *State) error {
+	if b.Hash(BlockHasher{}) == v.fail {
+		return fmt.Errorf("state check of block [%s] failed", v.fail)
+	}
+
+	return v.Validator.ValidateState(b, state)
+}
+
+func TestReorgHaltsWhenRestoreFails(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	blocks := addRandomBlocks(t, bc, 2)
+
+	failing := signedTx(t, []byte{0x52, 0x0c, 0x41, 0x0c, 0x42, 0x0c, 0x03, 0x0a, 0x0d, 0xae})
+	side1 := newBlockWithTxs(t, 1, blocks[0].PrevBlockHash, failing)
+	side2 := emptyBlock(t, side1)
+	side3 := emptyBlock(t, side2)
+	assert.Nil(t, bc.AddBlock(side1))
+	assert.Nil(t, bc.AddBlock(side2))
+
+	bc.SetValidator(restoreFailingValidator{Validator: bc.validator, fail: blocks[1].Hash(BlockHasher{})})
+	assert.ErrorIs(t, bc.AddBlock(side3), ErrChainHalted)
+
+	// a halted chain refuses every change
+	assert.ErrorIs(t, bc.AddBlock(emptyBlock(t, blocks[1])), ErrChainHalted)
+	_, _, err := bc.PrepareBlock(bc.TipHash(), nil)
+	assert.ErrorIs(t, err, ErrChainHalted)
+}
+
+func TestValidatorWeightForkChoice(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	genesis, err := bc.GetBlock(0)
+	assert.Nil(t, err)
+
+	heavy := crypto.GeneratePrivateKey()
+	assert.Nil(t, bc.SetForkChoice(ValidatorWeightRule{
+		Weights:       map[types.Address]uint64{heavy.PublicKey().Address(): 10},
+		DefaultWeight: 1,
+	}))
+
+	light1 := emptyBlock(t, genesis)
+	light2 := emptyBlock(t, light1)
+	assert.Nil(t, bc.AddBlock(light1))
+	assert.Nil(t, bc.AddBlock(light2))
+
+	heavy1 := emptyBlock(t, genesis)
+	assert.Nil(t, heavy1.Sign(heavy))
+	assert.Nil(t, bc.AddBlock(heavy1))
+
+	assert.Equal(t, uint32(1), bc.Height())
+	assert.True(t, bc.IsCanonical(heavy1.Hash(BlockHasher{})))
+
+	// switching back to the longest chain rule reorganises again
+	assert.Nil(t, bc.SetForkChoice(LongestChainRule{}))
+	assert.Equal(t, uint32(2), bc.Height())
+	assert.True(t, bc.IsCanonical(light2.Hash(BlockHasher{})))
+}
+
+func TestAddBlockStateRootMismatch(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	genesis, err := bc.GetBlock(0)
+	assert.Nil(t, err)
+
+	store := signedTx(t, []byte{0x02, 0x0a, 0x03, 0x0a, 0x0b, 0x4f, 0x0c, 0x4f, 0x0c, 0x46, 0x0c, 0x03, 0x0a, 0x0d, 0x0f})
+	_, root, err := bc.PrepareBlock(genesis.Hash(BlockHasher{}), []*Transaction{store})
+	assert.Nil(t, err)
+	assert.False(t, root.IsZero())
+	// computing the root leaves the state untouched
+	assert.Equal(t, types.Hash{}, bc.state.Root())
+
+	bad := newBlockWithStateRoot(t, 1, genesis.Hash(BlockHasher{}), randomHash(t), store)
+	assert.ErrorIs(t, bc.AddBlock(bad), ErrStateRootMismatch)
+	assert.Equal(t, uint32(0), bc.Height())
+	assert.Equal(t, types.Hash{}, bc.state.Root())
+
+	good := newBlockWithStateRoot(t, 1, genesis.Hash(BlockHasher{}), root, store)
+	assert.Nil(t, bc.AddBlock(good))
+	assert.Equal(t, root, bc.state.Root())
+}
+
+func TestAddBlockFailingTxLeavesStateUntouched(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	genesis, err := bc.GetBlock(0)
+	assert.Nil(t, err)
+
+	var (
+		store = signedTx(t, []byte{0x02, 0x0a, 0x03, 0x0a, 0x0b, 0x4f, 0x0c, 0x4f, 0x0c, 0x46, 0x0c, 0x03, 0x0a, 0x0d, 0x0f})
+		// reads the missing key BAR
+		failing = signedTx(t, []byte{0x52, 0x0c, 0x41, 0x0c, 0x42, 0x0c, 0x03, 0x0a, 0x0d, 0xae})
+		// pops from an empty stack, which panics inside the vm
+		panicking = signedTx(t, []byte{0x0b})
+	)
+
+	for _, bad := range []*Transaction{failing, panicking} {
+		b := newBlockWithTxs(t, 1, genesis.Hash(BlockHasher{}), store, bad)
+		assert.NotNil(t, bc.AddBlock(b))
+		assert.Equal(t, uint32(0), bc.Height())
+		assert.Equal(t, types.Hash{}, bc.state.Root())
+		_, err := bc.state.Get([]byte("FOO"))
+		assert.NotNil(t, err)
+	}
+}
+
+func TestPrepareBlockSkipsFailingTxs(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	genesis, err := bc.GetBlock(0)
+	assert.Nil(t, err)
+
+	var (
+		store   = signedTx(t, []byte{0x02, 0x0a, 0x03, 0x0a, 0x0b, 0x4f, 0x0c, 0x4f, 0x0c, 0x46, 0x0c, 0x03, 0x0a, 0x0d, 0x0f})
+		failing = signedTx(t, []byte{0x52, 0x0c, 0x41, 0x0c, 0x42, 0x0c, 0x03, 0x0a, 0x0d, 0xae})
+	)
+
+	included, root, err := bc.PrepareBlock(genesis.Hash(BlockHasher{}), []*Transaction{failing, store})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Transaction{store}, included)
+	assert.Equal(t, types.Hash{}, bc.state.Root())
+
+	b := newBlockWithStateRoot(t, 1, genesis.Hash(BlockHasher{}), root, included...)
+	assert.Nil(t, bc.AddBlock(b))
+	assert.Equal(t, root, bc.state.Root())
+
+	_, _, err = bc.PrepareBlock(genesis.Hash(BlockHasher{}), included)
+	assert.NotNil(t, err)
+}
+
+func TestPrepareBlockRespectsMaxBlockSize(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	genesis, err := bc.GetBlock(0)
+	assert.Nil(t, err)
+
+	// zero bytes are no-ops for the vm
+	txs := []*Transaction{}
+	for i := 0; i < 3; i++ {
+		txs = append(txs, signedTx(t, make([]byte, MaxBlockSize/3)))
+	}
+
+	included, root, err := bc.PrepareBlock(genesis.Hash(BlockHasher{}), txs)
+	assert.Nil(t, err)
+	assert.Equal(t, txs[:2], included)
+
+	b := newBlockWithStateRoot(t, 1, genesis.Hash(BlockHasher{}), root, included...)
+	assert.LessOrEqual(t, b.encodedSize(), MaxBlockSize)
+	assert.Nil(t, bc.AddBlock(b))
+
+	tooLarge := newBlockWithStateRoot(t, 2, b.Hash(BlockHasher{}), root, txs...)
+	assert.ErrorIs(t, bc.AddBlock(tooLarge), ErrBlockTooLarge)
+}
+
+func addRandomBlocks(t *testing.T, bc *Blockchain, n int) []*Block {
+	blocks := []*Block{}
+	for i := 0; i < n; i++ {
+		block := randomBlockOnTip(t, bc)
+		assert.Nil(t, bc.AddBlock(block))
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// randomBlockOnTip returns a block with a random transaction extending the
+// tip of bc, with the state root filled in.
+func randomBlockOnTip(t *testing.T, bc *Blockchain) *Block {
+	prev, err := bc.GetBlock(bc.Height())
+	assert.Nil(t, err)
+
+	tx := randomTxWithSignature(t)
+	included, root, err := bc.PrepareBlock(prev.Hash(BlockHasher{}), []*Transaction{tx})
+	assert.Nil(t, err)
+	assert.Len(t, included, 1)
+
+	return newBlockWithStateRoot(t, prev.Height+1, prev.Hash(BlockHasher{}), root, tx)
+}
+
+// emptyBlock returns a block without transactions extending parent, which
+// leaves the state as it was after parent.
+func emptyBlock(t *testing.T, parent *Block) *Block {
+	return newBlockWithStateRoot(t, parent.Height+1, parent.Hash(BlockHasher{}), parent.StateRoot)
+}
+
+func newBlockWithTxs(t *testing.T, height uint32, prevBlockHash types.Hash, txs ...*Transaction) *Block {
+	return newBlockWithStateRoot(t, height, prevBlockHash, types.Hash{}, txs...)
+}
+
+func newBlockWithStateRoot(t *testing.T, height uint32, prevBlockHash, stateRoot types.Hash, txs ...*Transaction) *Block {
+	header := &Header{
+		Version:       1,
+		PrevBlockHash: prevBlockHash,
+		StateRoot:     stateRoot,
+		Timestamp:     time.Now().UnixNano(),
+		Height:        height,
+	}
+
+	b, err := NewBlock(header, txs)
+	assert.Nil(t, err)
+	dataHash, err := CalculateDataHash(b.Transactions)
+	assert.Nil(t, err)
+	b.Header.DataHash = dataHash
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+
+	return b
+}
+
+func signedTx(t *testing.T, data []byte) *Transaction {
+	tx := NewTransaction(data)
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+
+	return tx
+}
+
 func newBlockchainWithGenesis(t *testing.T) *Blockchain {
-	bc, err := NewBlockchain(log.NewNopLogger(), randomBlock(t, 0, types.Hash{}))
+	bc, err := NewBlockchain(log.NewNopLogger(), randomGenesis(t))
 	assert.Nil(t, err)
 
 	return bc
 }
 
+func randomGenesis(t *testing.T) *Block {
+	genesis, err := NewGenesisBlock(&Header{Version: 1, Timestamp: time.Now().UnixNano()}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, genesis.Sign(crypto.GeneratePrivateKey()))
+
+	return genesis
+}
+
 func getPrevBlockHash(t *testing.T, bc *Blockchain, height uint32) types.Hash {
 	prevHeader, err := bc.GetHeader(height - 1)
 	assert.Nil(t, err)
 	return BlockHasher{}.Hash(prevHeader)
 }
+
+func TestForeignChainIDRejected(t *testing.T) {
+	genesis, err := NewGenesisBlock(&Header{Version: 1, ChainID: 7}, nil)
+	assert.Nil(t, err)
+	bc, err := NewBlockchain(log.NewNopLogger(), genesis)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), bc.ChainID())
+
+	foreign := emptyBlock(t, genesis)
+	foreign.ChainID = 8
+	assert.Nil(t, foreign.Sign(crypto.GeneratePrivateKey()))
+	assert.ErrorIs(t, bc.AddBlock(foreign), ErrChainIDMismatch)
+
+	// a tx signed for another chain can not be included
+	tx := NewTransaction([]byte("foo"))
+	tx.ChainID = 8
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	b := newBlockWithStateRoot(t, 1, genesis.Hash(BlockHasher{}), genesis.StateRoot, tx)
+	b.ChainID = 7
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+	assert.ErrorIs(t, bc.AddBlock(b), ErrChainIDMismatch)
+
+	ok := emptyBlock(t, genesis)
+	ok.ChainID = 7
+	assert.Nil(t, ok.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, bc.AddBlock(ok))
+}
+
+func TestGetTransaction(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	genesis, err := bc.GetBlock(0)
+	assert.Nil(t, err)
+
+	block := randomBlockOnTip(t, bc)
+	assert.Nil(t, bc.AddBlock(block))
+
+	tx := block.Transactions[0]
+	found, err := bc.GetTransaction(tx.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, tx, found)
+
+	// the tx is forgotten once its block leaves the canonical chain
+	side1 := emptyBlock(t, genesis)
+	side2 := emptyBlock(t, side1)
+	assert.Nil(t, bc.AddBlock(side1))
+	assert.Nil(t, bc.AddBlock(side2))
+
+	_, err = bc.GetTransaction(tx.Hash(TxHasher{}))
+	assert.ErrorIs(t, err, ErrUnknownTx)
+}
+
+func TestGetBlockByHash(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	lenBlocks := 10
+
+	for i := 0; i < lenBlocks; i++ {
+		block := randomBlockOnTip(t, bc)
+		assert.Nil(t, bc.AddBlock(block))
+
+		b, err := bc.GetBlockByHash(block.Hash(BlockHasher{}))
+		assert.Nil(t, err)
+		assert.Equal(t, block, b)
+
+		header, err := bc.GetHeaderByHash(block.Hash(BlockHasher{}))
+		assert.Nil(t, err)
+		assert.Equal(t, block.Header, header)
+	}
+
+	_, err := bc.GetBlockByHash(types.Hash{})
+	assert.ErrorIs(t, err, ErrUnknownHash)
+
+	_, err = bc.GetHeaderByHash(types.Hash{0x01})
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+// blockNode is an entry in the block tree. Every known block has a node,
+// whether it is part of the canonical chain or of a side branch.
+type blockNode struct {
+	block  *Block
+	hash   types.Hash
+	parent *blockNode
+	// cumulative fork choice score of the chain ending at this block
+	score *big.Int
+	// the block failed to execute and can never become canonical
+	invalid bool
+	// state changes made when the block was connected to the canonical chain,
+	// used to roll the state back when the block is disconnected
+	undo []stateChange
+}
+
+func newBlockNode(b *Block, parent *blockNode, rule ForkChoiceRule) *blockNode {
+	node := &blockNode{
+		block:  b,
+		hash:   b.Hash(BlockHasher{}),
+		parent: parent,
+	}
+	node.updateScore(rule)
+
+	return node
+}
+
+func (n *blockNode) height() uint32 {
+	return n.block.Height
+}
+
+func (n *blockNode) updateScore(rule ForkChoiceRule) {
+	score := new(big.Int).Set(rule.BlockScore(n.block))
+	if n.parent != nil {
+		score.Add(score, n.parent.score)
+	}
+	n.score = score
+}
+
+// betterThan reports whether the chain ending at n should replace the chain
+// ending at other.
+func (n *blockNode) betterThan(other *blockNode) bool {
+	return n.score.Cmp(other.score) > 0
+}
+
+// hasInvalidAncestor reports whether n or any of its ancestors failed to execute.
+func (n *blockNode) hasInvalidAncestor() bool {
+	for node := n; node != nil; node = node.parent {
+		if node.invalid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findFork returns the common ancestor of a and b together with the nodes of
+// both branches above it, ordered from the ancestor towards the tips.
+func findFork(a, b *blockNode) (ancestor *blockNode, branchA, branchB []*blockNode) {
+	for a.height() > b.height() {
+		branchA = append(branchA, a)
+		a = a.parent
+	}
+	for b.height() > a.height() {
+		branchB = append(branchB, b)
+		b = b.parent
+	}
+	for a != b {
+		branchA = append(branchA, a)
+		branchB = append(branchB, b)
+		a = a.parent
+		b = b.parent
+	}
+
+	reverseNodes(branchA)
+	reverseNodes(branchB)
+
+	return a, branchA, branchB
+}
+
+func reverseNodes(nodes []*blockNode) {
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+}
+
+func sortNodesByHeight(nodes []*blockNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].height() < nodes[j].height()
+	})
+}
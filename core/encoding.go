@@ -3,6 +3,7 @@ package core
 import (
 	"crypto/elliptic"
 	"encoding/gob"
+	"encoding/json"
 	"io"
 )
 
@@ -62,6 +63,82 @@ func (dec *GobBlockDecoder) Decode(block *Block) error {
 	return gob.NewDecoder(dec.r).Decode(block)
 }
 
+// The JSON encoders write hashes and public keys as hex strings, addresses in
+// their bech32 form with the default prefix and the signature as its R and S
+// values in hex.
+
+type JSONHeaderEncoder struct {
+	w io.Writer
+}
+
+func NewJSONHeaderEncoder(w io.Writer) *JSONHeaderEncoder {
+	return &JSONHeaderEncoder{w: w}
+}
+
+func (e *JSONHeaderEncoder) Encode(h *Header) error {
+	return json.NewEncoder(e.w).Encode(h)
+}
+
+type JSONHeaderDecoder struct {
+	r io.Reader
+}
+
+func NewJSONHeaderDecoder(r io.Reader) *JSONHeaderDecoder {
+	return &JSONHeaderDecoder{r: r}
+}
+
+func (d *JSONHeaderDecoder) Decode(h *Header) error {
+	return json.NewDecoder(d.r).Decode(h)
+}
+
+type JSONTxEncoder struct {
+	w io.Writer
+}
+
+func NewJSONTxEncoder(w io.Writer) *JSONTxEncoder {
+	return &JSONTxEncoder{w: w}
+}
+
+func (e *JSONTxEncoder) Encode(tx *Transaction) error {
+	return json.NewEncoder(e.w).Encode(tx)
+}
+
+type JSONTxDecoder struct {
+	r io.Reader
+}
+
+func NewJSONTxDecoder(r io.Reader) *JSONTxDecoder {
+	return &JSONTxDecoder{r: r}
+}
+
+func (d *JSONTxDecoder) Decode(tx *Transaction) error {
+	return json.NewDecoder(d.r).Decode(tx)
+}
+
+type JSONBlockEncoder struct {
+	w io.Writer
+}
+
+func NewJSONBlockEncoder(w io.Writer) *JSONBlockEncoder {
+	return &JSONBlockEncoder{w: w}
+}
+
+func (e *JSONBlockEncoder) Encode(b *Block) error {
+	return json.NewEncoder(e.w).Encode(b)
+}
+
+type JSONBlockDecoder struct {
+	r io.Reader
+}
+
+func NewJSONBlockDecoder(r io.Reader) *JSONBlockDecoder {
+	return &JSONBlockDecoder{r: r}
+}
+
+func (d *JSONBlockDecoder) Decode(b *Block) error {
+	return json.NewDecoder(d.r).Decode(b)
+}
+
 func init() {
 	gob.Register(elliptic.P256())
 }
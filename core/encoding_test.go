@@ -0,0 +1,59 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dbkbali/bcbasic/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONTxGolden(t *testing.T) {
+	tx := goldenTx()
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, tx.Encode(NewJSONTxEncoder(buf)))
+	assert.JSONEq(t, `{
+		"Data": "Zm9v",
+		"To": "bcb1pg9q5zs2pg9q5zs2pg9q5zs2pg9q5zs265tr0m",
+		"Value": 5,
+		"Nonce": 3,
+		"ChainID": 9,
+		"From": "02aabb",
+		"Signature": {"Scheme": 1, "R": "1", "S": "2"},
+		"Multisig": null,
+		"MultisigSignatures": null
+	}`, buf.String())
+
+	decoded := new(Transaction)
+	assert.Nil(t, decoded.Decode(NewJSONTxDecoder(buf)))
+	assert.Equal(t, tx, decoded)
+}
+
+func TestJSONHeaderEncodeDecode(t *testing.T) {
+	h := goldenHeader()
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, h.Encode(NewJSONHeaderEncoder(buf)))
+	assert.Contains(t, buf.String(), `"DataHash":"`+hashOf(0x01).String()+`"`)
+
+	decoded := new(Header)
+	assert.Nil(t, decoded.Decode(NewJSONHeaderDecoder(buf)))
+	assert.Equal(t, h, decoded)
+}
+
+func TestJSONBlockEncodeDecode(t *testing.T) {
+	b := randomBlock(t, 1, types.Hash{})
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, b.Encode(NewJSONBlockEncoder(buf)))
+
+	decoded := new(Block)
+	assert.Nil(t, decoded.Decode(NewJSONBlockDecoder(buf)))
+	// the tx hashes are cached on the original only
+	for _, tx := range decoded.Transactions {
+		tx.Hash(TxHasher{})
+	}
+	assert.Equal(t, b, decoded)
+	assert.Nil(t, decoded.Verify())
+}
@@ -0,0 +1,350 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+const (
+	defaultMaxSegmentSize = 64 << 20
+	segmentExt            = ".seg"
+	// every record is prefixed with the payload length and its crc32 checksum
+	recordHeaderSize = 8
+)
+
+var (
+	ErrClosed        = errors.New("storage closed")
+	errCorruptRecord = errors.New("corrupt storage record")
+)
+
+type recordLocation struct {
+	segment int
+	offset  int64
+	size    uint32
+}
+
+// FileStore is an append only Storage. Blocks are written as length prefixed,
+// checksummed records into numbered segment files inside dir and synced to
+// disk before Put returns. The hash index is kept in memory and rebuilt by
+// scanning the segments on open.
+type FileStore struct {
+	lock           sync.RWMutex
+	dir            string
+	maxSegmentSize int64
+	segments       []*os.File
+	// size of the active (last) segment
+	activeSize int64
+	closed     bool
+
+	order  []recordLocation
+	byHash map[types.Hash]recordLocation
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	return NewFileStoreWithSegmentSize(dir, defaultMaxSegmentSize)
+}
+
+func NewFileStoreWithSegmentSize(dir string, maxSegmentSize int64) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		dir:            dir,
+		maxSegmentSize: maxSegmentSize,
+		order:          []recordLocation{},
+		byHash:         make(map[types.Hash]recordLocation),
+	}
+
+	if err := s.open(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Put(b *Block) error {
+	hash := b.Hash(BlockHasher{})
+
+	buf := &bytes.Buffer{}
+	if err := b.Encode(NewBinaryBlockEncoder(buf)); err != nil {
+		return err
+	}
+	payload := buf.Bytes()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if _, ok := s.byHash[hash]; ok {
+		return nil
+	}
+
+	size := int64(recordHeaderSize + len(payload))
+	if s.activeSize > 0 && s.activeSize+size > s.maxSegmentSize {
+		if err := s.addSegment(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	segment := len(s.segments) - 1
+	if _, err := s.segments[segment].WriteAt(record, s.activeSize); err != nil {
+		return err
+	}
+	if err := s.segments[segment].Sync(); err != nil {
+		return err
+	}
+
+	loc := recordLocation{
+		segment: segment,
+		offset:  s.activeSize,
+		size:    uint32(len(payload)),
+	}
+	s.activeSize += size
+	s.index(loc, hash)
+
+	return nil
+}
+
+func (s *FileStore) GetByHash(hash types.Hash) (*Block, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+	loc, ok := s.byHash[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: hash [%s]", ErrBlockNotStored, hash)
+	}
+
+	return s.read(loc)
+}
+
+func (s *FileStore) Has(hash types.Hash) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.byHash[hash]
+	return ok
+}
+
+func (s *FileStore) Iterate(fn func(*Block) error) error {
+	s.lock.RLock()
+	order := make([]recordLocation, len(s.order))
+	copy(order, s.order)
+	s.lock.RUnlock()
+
+	for _, loc := range order {
+		s.lock.RLock()
+		var (
+			b   *Block
+			err = ErrClosed
+		)
+		if !s.closed {
+			b, err = s.read(loc)
+		}
+		s.lock.RUnlock()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close syncs and closes the segments. The store can not be used afterwards,
+// its methods return ErrClosed.
+func (s *FileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var firstErr error
+	for _, f := range s.segments {
+		if err := f.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.segments = nil
+
+	return firstErr
+}
+
+func (s *FileStore) index(loc recordLocation, hash types.Hash) {
+	s.order = append(s.order, loc)
+	s.byHash[hash] = loc
+}
+
+func (s *FileStore) read(loc recordLocation) (*Block, error) {
+	payload := make([]byte, loc.size)
+	if _, err := s.segments[loc.segment].ReadAt(payload, loc.offset+recordHeaderSize); err != nil {
+		return nil, err
+	}
+
+	return decodeStoredBlock(payload)
+}
+
+// open loads the existing segments in dir and rebuilds the indexes. A partially
+// written record at the tail of the last segment is truncated away.
+func (s *FileStore) open() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if filepath.Base(name) != segmentName(i) {
+			return fmt.Errorf("unexpected segment file [%s] in [%s]", filepath.Base(name), s.dir)
+		}
+
+		f, err := os.OpenFile(name, os.O_RDWR, 0o644)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, f)
+
+		end, err := s.scan(i)
+		if err != nil {
+			if !errors.Is(err, errCorruptRecord) || i != len(names)-1 {
+				return fmt.Errorf("segment [%s]: %w", name, err)
+			}
+			if err := f.Truncate(end); err != nil {
+				return err
+			}
+		}
+		s.activeSize = end
+	}
+
+	if len(s.segments) == 0 {
+		return s.addSegment()
+	}
+
+	return nil
+}
+
+// scan indexes every record in the given segment and returns the offset just
+// past the last valid record.
+func (s *FileStore) scan(segment int) (int64, error) {
+	f := s.segments[segment]
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		offset int64
+		size   = info.Size()
+		header = make([]byte, recordHeaderSize)
+	)
+
+	for offset < size {
+		if offset+recordHeaderSize > size {
+			return offset, errCorruptRecord
+		}
+		if _, err := f.ReadAt(header, offset); err != nil {
+			return offset, err
+		}
+
+		var (
+			length   = binary.BigEndian.Uint32(header[0:4])
+			checksum = binary.BigEndian.Uint32(header[4:8])
+		)
+
+		if offset+recordHeaderSize+int64(length) > size {
+			return offset, errCorruptRecord
+		}
+
+		payload := make([]byte, length)
+		if _, err := f.ReadAt(payload, offset+recordHeaderSize); err != nil {
+			return offset, err
+		}
+
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return offset, errCorruptRecord
+		}
+
+		b, err := decodeStoredBlock(payload)
+		if err != nil {
+			return offset, fmt.Errorf("%w: %s", errCorruptRecord, err)
+		}
+
+		loc := recordLocation{
+			segment: segment,
+			offset:  offset,
+			size:    length,
+		}
+		s.index(loc, b.Hash(BlockHasher{}))
+
+		offset += recordHeaderSize + int64(length)
+	}
+
+	return offset, nil
+}
+
+func (s *FileStore) addSegment() error {
+	name := filepath.Join(s.dir, segmentName(len(s.segments)))
+
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, f)
+	s.activeSize = 0
+
+	// the new file only survives a crash once its directory entry is synced
+	return syncDir(s.dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+func segmentName(n int) string {
+	return fmt.Sprintf("%08d%s", n, segmentExt)
+}
+
+func decodeStoredBlock(payload []byte) (*Block, error) {
+	b := new(Block)
+	if err := b.Decode(NewBinaryBlockDecoder(bytes.NewReader(payload))); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+// ForkChoiceRule decides which branch of the block tree is canonical. Every
+// block adds its score to the chain it extends and the chain with the highest
+// cumulative score wins. On a tie the chain seen first is kept.
+type ForkChoiceRule interface {
+	BlockScore(b *Block) *big.Int
+}
+
+// LongestChainRule prefers the chain with the most blocks.
+type LongestChainRule struct{}
+
+func (LongestChainRule) BlockScore(*Block) *big.Int {
+	return big.NewInt(1)
+}
+
+// MostWorkRule treats the header hash as a proof of work and prefers the
+// chain with the most cumulative work. The work of a block is 2^256 / (hash+1),
+// so blocks with a lower hash count for more.
+type MostWorkRule struct{}
+
+var maxHashValue = new(big.Int).Lsh(big.NewInt(1), 256)
+
+func (MostWorkRule) BlockScore(b *Block) *big.Int {
+	hash := b.Hash(BlockHasher{})
+	target := new(big.Int).SetBytes(hash.ToSlice())
+	target.Add(target, big.NewInt(1))
+
+	return new(big.Int).Div(maxHashValue, target)
+}
+
+// ValidatorWeightRule prefers the chain whose blocks were produced by the
+// validators with the highest combined weight. Validators that are not
+// listed in Weights have a weight of DefaultWeight.
+type ValidatorWeightRule struct {
+	Weights       map[types.Address]uint64
+	DefaultWeight uint64
+}
+
+func (r ValidatorWeightRule) BlockScore(b *Block) *big.Int {
+	weight, ok := r.Weights[b.Validator.Address()]
+	if !ok {
+		weight = r.DefaultWeight
+	}
+
+	return new(big.Int).SetUint64(weight)
+}
@@ -16,8 +16,10 @@ func (BlockHasher) Hash(b *Header) types.Hash {
 	return types.Hash(h)
 }
 
+// TxHasher hashes the signed fields of a transaction together with its
+// sender, so the same payload sent by two senders has two hashes.
 type TxHasher struct{}
 
 func (TxHasher) Hash(tx *Transaction) types.Hash {
-	return types.Hash(sha256.Sum256(tx.Data))
+	return types.Hash(sha256.Sum256(tx.hashBytes()))
 }
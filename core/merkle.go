@@ -0,0 +1,139 @@
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+// Leaves and inner nodes are hashed with different prefixes so an inner node
+// can never be passed off as a leaf.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleProof proves that a leaf is part of a merkle tree. Hashes holds the
+// sibling hashes on the path from the leaf up to the root.
+type MerkleProof struct {
+	Index  uint32
+	Total  uint32
+	Hashes []types.Hash
+}
+
+// MerkleRoot returns the root of a binary merkle tree over leaves. A node
+// without a sibling is promoted to the next level unchanged, and the root of
+// an empty tree is the zero hash.
+func MerkleRoot(leaves []types.Hash) types.Hash {
+	if len(leaves) == 0 {
+		return types.Hash{}
+	}
+
+	level := make([]types.Hash, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = merkleLeafHash(leaf)
+	}
+
+	for len(level) > 1 {
+		level = nextMerkleLevel(level)
+	}
+
+	return level[0]
+}
+
+// NewMerkleProof builds the inclusion proof of the leaf at index.
+func NewMerkleProof(leaves []types.Hash, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("merkle proof index [%d] out of range [%d]", index, len(leaves))
+	}
+
+	proof := &MerkleProof{
+		Index:  uint32(index),
+		Total:  uint32(len(leaves)),
+		Hashes: []types.Hash{},
+	}
+
+	level := make([]types.Hash, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = merkleLeafHash(leaf)
+	}
+
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Hashes = append(proof.Hashes, level[sibling])
+		}
+
+		level = nextMerkleLevel(level)
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// Verify reports whether the proof shows that leaf is part of the tree with
+// the given root.
+func (p *MerkleProof) Verify(root, leaf types.Hash) bool {
+	if p.Total == 0 || p.Index >= p.Total {
+		return false
+	}
+
+	var (
+		hash  = merkleLeafHash(leaf)
+		index = p.Index
+		size  = p.Total
+		used  = 0
+	)
+
+	for size > 1 {
+		sibling := index ^ 1
+		if sibling < size {
+			if used >= len(p.Hashes) {
+				return false
+			}
+
+			if index%2 == 0 {
+				hash = merkleNodeHash(hash, p.Hashes[used])
+			} else {
+				hash = merkleNodeHash(p.Hashes[used], hash)
+			}
+			used++
+		}
+
+		index /= 2
+		size = (size + 1) / 2
+	}
+
+	return used == len(p.Hashes) && hash == root
+}
+
+func nextMerkleLevel(level []types.Hash) []types.Hash {
+	next := make([]types.Hash, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, merkleNodeHash(level[i], level[i+1]))
+	}
+
+	return next
+}
+
+func merkleLeafHash(leaf types.Hash) types.Hash {
+	buf := make([]byte, 0, 1+len(leaf))
+	buf = append(buf, merkleLeafPrefix)
+	buf = append(buf, leaf[:]...)
+
+	return types.Hash(sha256.Sum256(buf))
+}
+
+func merkleNodeHash(left, right types.Hash) types.Hash {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, merkleNodePrefix)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+
+	return types.Hash(sha256.Sum256(buf))
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/dbkbali/bcbasic/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerkleRootEmpty(t *testing.T) {
+	assert.Equal(t, types.Hash{}, MerkleRoot(nil))
+}
+
+func TestMerkleRootSingleLeaf(t *testing.T) {
+	leaf := randomHash(t)
+	assert.Equal(t, merkleLeafHash(leaf), MerkleRoot([]types.Hash{leaf}))
+}
+
+func TestMerkleRootPromotesOddNode(t *testing.T) {
+	leaves := []types.Hash{randomHash(t), randomHash(t), randomHash(t)}
+
+	left := merkleNodeHash(merkleLeafHash(leaves[0]), merkleLeafHash(leaves[1]))
+	expected := merkleNodeHash(left, merkleLeafHash(leaves[2]))
+	assert.Equal(t, expected, MerkleRoot(leaves))
+
+	// duplicating the last leaf must change the root
+	assert.NotEqual(t, MerkleRoot(leaves), MerkleRoot(append(leaves, leaves[2])))
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		leaves := make([]types.Hash, n)
+		for i := range leaves {
+			leaves[i] = randomHash(t)
+		}
+		root := MerkleRoot(leaves)
+
+		for i := 0; i < n; i++ {
+			proof, err := NewMerkleProof(leaves, i)
+			assert.Nil(t, err)
+			assert.True(t, proof.Verify(root, leaves[i]), "n=%d i=%d", n, i)
+			assert.False(t, proof.Verify(root, randomHash(t)))
+
+			if n > 1 {
+				proof.Index = uint32((i + 1) % n)
+				assert.False(t, proof.Verify(root, leaves[i]))
+			}
+		}
+	}
+
+	_, err := NewMerkleProof([]types.Hash{randomHash(t)}, 1)
+	assert.NotNil(t, err)
+}
+
+func TestBlockTxProof(t *testing.T) {
+	txs := []*Transaction{}
+	for i := 0; i < 5; i++ {
+		txs = append(txs, signedTx(t, []byte{byte(i)}))
+	}
+	b := newBlockWithTxs(t, 1, types.Hash{}, txs...)
+
+	for i, tx := range b.Transactions {
+		proof, err := b.TxProof(i)
+		assert.Nil(t, err)
+		assert.True(t, VerifyTxInclusion(b.Header, tx, proof))
+	}
+
+	proof, err := b.TxProof(0)
+	assert.Nil(t, err)
+	assert.False(t, VerifyTxInclusion(b.Header, signedTx(t, []byte("other")), proof))
+}
+
+func randomHash(t *testing.T) types.Hash {
+	var h types.Hash
+	_, err := rand.Read(h[:])
+	assert.Nil(t, err)
+
+	return h
+}
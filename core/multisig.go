@@ -0,0 +1,124 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/dbkbali/bcbasic/types"
+)
+
+// maxMultisigKeys bounds the number of keys of a multisig account.
+const maxMultisigKeys = 16
+
+// multisigAddressTag separates multisig addresses from the addresses of
+// single keys, which hash a public key starting with its scheme byte.
+const multisigAddressTag = "bcbasic/multisig"
+
+var (
+	ErrInvalidMultisig      = errors.New("invalid multisig account")
+	ErrMultisigThreshold    = errors.New("multisig threshold not reached")
+	ErrNotMultisigKey       = errors.New("key is not part of the multisig account")
+	ErrDuplicateMultisigSig = errors.New("duplicate multisig signature")
+)
+
+// MultisigAccount is an account controlled by Threshold of its Keys. The keys
+// are kept sorted so the same key set always has the same address.
+type MultisigAccount struct {
+	Threshold uint32
+	Keys      []crypto.PublicKey
+}
+
+// MultisigSignature is the signature of the key at KeyIndex in the sorted
+// keys of the multisig account.
+type MultisigSignature struct {
+	KeyIndex  uint32
+	Signature *crypto.Signature
+}
+
+func NewMultisigAccount(threshold uint32, keys ...crypto.PublicKey) (*MultisigAccount, error) {
+	sorted := make([]crypto.PublicKey, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	m := &MultisigAccount{
+		Threshold: threshold,
+		Keys:      sorted,
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Address derives the address from the threshold and the sorted keys.
+func (m *MultisigAccount) Address() types.Address {
+	buf := &bytes.Buffer{}
+	buf.WriteString(multisigAddressTag)
+	bw := &binaryWriter{w: buf}
+	bw.multisig(m)
+
+	h := sha256.Sum256(buf.Bytes())
+	return types.AddressFromBytes(h[len(h)-20:])
+}
+
+// KeyIndex returns the index of key in the sorted keys.
+func (m *MultisigAccount) KeyIndex(key crypto.PublicKey) (uint32, error) {
+	for i, k := range m.Keys {
+		if bytes.Equal(k, key) {
+			return uint32(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: [%s]", ErrNotMultisigKey, key)
+}
+
+// Verify checks that at least Threshold distinct keys signed data.
+func (m *MultisigAccount) Verify(sigs []*MultisigSignature, data []byte) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	signed := make(map[uint32]bool, len(sigs))
+	for _, sig := range sigs {
+		if sig.KeyIndex >= uint32(len(m.Keys)) {
+			return fmt.Errorf("%w: key index %d of %d keys", ErrNotMultisigKey, sig.KeyIndex, len(m.Keys))
+		}
+		if signed[sig.KeyIndex] {
+			return fmt.Errorf("%w: key index %d", ErrDuplicateMultisigSig, sig.KeyIndex)
+		}
+		if sig.Signature == nil || !sig.Signature.Verify(m.Keys[sig.KeyIndex], data) {
+			return fmt.Errorf("invalid signature of key index %d", sig.KeyIndex)
+		}
+		signed[sig.KeyIndex] = true
+	}
+
+	if uint32(len(signed)) < m.Threshold {
+		return fmt.Errorf("%w: %d of %d signatures", ErrMultisigThreshold, len(signed), m.Threshold)
+	}
+
+	return nil
+}
+
+func (m *MultisigAccount) validate() error {
+	if len(m.Keys) == 0 || len(m.Keys) > maxMultisigKeys {
+		return fmt.Errorf("%w: %d keys, expected 1 to %d", ErrInvalidMultisig, len(m.Keys), maxMultisigKeys)
+	}
+	if m.Threshold == 0 || m.Threshold > uint32(len(m.Keys)) {
+		return fmt.Errorf("%w: threshold %d of %d keys", ErrInvalidMultisig, m.Threshold, len(m.Keys))
+	}
+
+	for i := 1; i < len(m.Keys); i++ {
+		if bytes.Compare(m.Keys[i-1], m.Keys[i]) >= 0 {
+			return fmt.Errorf("%w: keys not sorted or not unique", ErrInvalidMultisig)
+		}
+	}
+
+	return nil
+}
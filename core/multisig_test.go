@@ -0,0 +1,96 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultisigAddress(t *testing.T) {
+	a := crypto.GeneratePrivateKey().PublicKey()
+	b := crypto.GenerateEd25519PrivateKey().PublicKey()
+	c := crypto.GeneratePrivateKey().PublicKey()
+
+	m1, err := NewMultisigAccount(2, a, b, c)
+	assert.Nil(t, err)
+	m2, err := NewMultisigAccount(2, c, a, b)
+	assert.Nil(t, err)
+	assert.Equal(t, m1.Address(), m2.Address())
+
+	m3, err := NewMultisigAccount(3, a, b, c)
+	assert.Nil(t, err)
+	assert.NotEqual(t, m1.Address(), m3.Address())
+
+	single, err := NewMultisigAccount(1, a)
+	assert.Nil(t, err)
+	assert.NotEqual(t, a.Address(), single.Address())
+
+	_, err = NewMultisigAccount(0, a, b)
+	assert.ErrorIs(t, err, ErrInvalidMultisig)
+	_, err = NewMultisigAccount(3, a, b)
+	assert.ErrorIs(t, err, ErrInvalidMultisig)
+	_, err = NewMultisigAccount(1, a, a)
+	assert.ErrorIs(t, err, ErrInvalidMultisig)
+}
+
+func TestMultisigTxVerify(t *testing.T) {
+	keys := []crypto.Signer{
+		crypto.GeneratePrivateKey(),
+		crypto.GenerateEd25519PrivateKey(),
+		crypto.GeneratePrivateKey(),
+	}
+	m, err := NewMultisigAccount(2, keys[0].PublicKey(), keys[1].PublicKey(), keys[2].PublicKey())
+	assert.Nil(t, err)
+
+	tx := NewTransaction([]byte("foo"))
+	tx.Multisig = m
+
+	assert.Nil(t, tx.SignMultisig(keys[0]))
+	assert.ErrorIs(t, tx.Verify(), ErrMultisigThreshold)
+
+	// the same key twice does not count
+	tx.MultisigSignatures = append(tx.MultisigSignatures, tx.MultisigSignatures[0])
+	assert.ErrorIs(t, tx.Verify(), ErrDuplicateMultisigSig)
+	tx.MultisigSignatures = tx.MultisigSignatures[:1]
+
+	assert.Nil(t, tx.SignMultisig(keys[2]))
+	assert.Nil(t, tx.Verify())
+	assert.Equal(t, m.Address(), tx.Sender())
+
+	assert.ErrorIs(t, tx.SignMultisig(crypto.GeneratePrivateKey()), ErrNotMultisigKey)
+
+	// the signatures cover the account
+	other, err := NewMultisigAccount(1, keys[0].PublicKey(), keys[2].PublicKey())
+	assert.Nil(t, err)
+	tx.Multisig = other
+	assert.NotNil(t, tx.Verify())
+}
+
+func TestMultisigTransfer(t *testing.T) {
+	var (
+		alice = crypto.GeneratePrivateKey()
+		bob   = crypto.GeneratePrivateKey()
+		to    = crypto.GeneratePrivateKey().PublicKey().Address()
+	)
+
+	m, err := NewMultisigAccount(2, alice.PublicKey(), bob.PublicKey())
+	assert.Nil(t, err)
+
+	bc := newBlockchainWithAlloc(t, GenesisAlloc{m.Address(): 100})
+
+	tx := NewTransferTransaction(to, 40)
+	tx.Multisig = m
+	assert.Nil(t, tx.SignMultisig(alice))
+	assert.Nil(t, tx.SignMultisig(bob))
+	addBlockWithTxs(t, bc, tx)
+
+	acc, err := bc.GetAccount(m.Address())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(60), acc.Balance)
+	assert.Equal(t, uint64(1), acc.Nonce)
+
+	acc, err = bc.GetAccount(to)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(40), acc.Balance)
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"runtime"
+	"sync"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+const defaultSigCacheSize = 1 << 14
+
+// SigCache remembers the transactions whose signatures verified, so a
+// transaction checked on mempool entry is not checked again when its block is
+// imported. Entries are keyed by the tx hash, computed afresh on every lookup
+// so a changed field misses the cache, and hold a digest of the signatures,
+// because the hash does not cover them. The oldest entry is evicted once the
+// cache is full.
+type SigCache struct {
+	lock    sync.RWMutex
+	entries map[types.Hash]types.Hash
+	// ring of the cached hashes in insertion order
+	order []types.Hash
+	next  int
+}
+
+func NewSigCache(size int) *SigCache {
+	return &SigCache{
+		entries: make(map[types.Hash]types.Hash, size),
+		order:   make([]types.Hash, 0, size),
+	}
+}
+
+// Contains reports whether tx, with its current signatures, verified before.
+func (c *SigCache) Contains(tx *Transaction) bool {
+	digest, ok := signaturesDigest(tx)
+	if !ok {
+		return false
+	}
+	hash := TxHasher{}.Hash(tx)
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	cached, ok := c.entries[hash]
+	return ok && cached == digest
+}
+
+// Add records that the signatures of tx verified.
+func (c *SigCache) Add(tx *Transaction) {
+	digest, ok := signaturesDigest(tx)
+	if !ok || cap(c.order) == 0 {
+		return
+	}
+	hash := TxHasher{}.Hash(tx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.entries[hash]; ok {
+		c.entries[hash] = digest
+		return
+	}
+
+	if len(c.order) < cap(c.order) {
+		c.order = append(c.order, hash)
+	} else {
+		delete(c.entries, c.order[c.next])
+		c.order[c.next] = hash
+		c.next = (c.next + 1) % len(c.order)
+	}
+	c.entries[hash] = digest
+}
+
+func (c *SigCache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return len(c.entries)
+}
+
+func signaturesDigest(tx *Transaction) (types.Hash, bool) {
+	buf := &bytes.Buffer{}
+	bw := &binaryWriter{w: buf}
+	bw.signatures(tx)
+	if bw.err != nil {
+		return types.Hash{}, false
+	}
+
+	return sha256.Sum256(buf.Bytes()), true
+}
+
+// VerifyTransactions checks the signatures of txs on a pool of GOMAXPROCS
+// workers. Transactions found in cache are skipped and the ones that verify
+// are added to it; cache may be nil. The error of the first invalid
+// transaction in txs is returned.
+func VerifyTransactions(txs []*Transaction, cache *SigCache) error {
+	return verifyTransactions(txs, cache, runtime.GOMAXPROCS(0))
+}
+
+func verifyTransactions(txs []*Transaction, cache *SigCache, workers int) error {
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+
+	errs := make([]error, len(txs))
+	indexes := make(chan int)
+
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				errs[i] = verifyTransaction(txs[i], cache)
+			}
+		}()
+	}
+
+	for i := range txs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func verifyTransaction(tx *Transaction, cache *SigCache) error {
+	if cache != nil && cache.Contains(tx) {
+		return nil
+	}
+
+	if err := tx.Verify(); err != nil {
+		return err
+	}
+
+	if cache != nil {
+		cache.Add(tx)
+	}
+
+	return nil
+}
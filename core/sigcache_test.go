@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"runtime"
+	"testing"
+
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyTransactions(t *testing.T) {
+	txs := signedTxs(t, 32)
+	assert.Nil(t, VerifyTransactions(txs, nil))
+
+	// the error of the first invalid transaction is returned
+	txs[20].Data = []byte("tampered")
+	txs[7].Value = 1
+	err := VerifyTransactions(txs, nil)
+	assert.Equal(t, txs[7].Verify(), err)
+}
+
+func TestSigCache(t *testing.T) {
+	txs := signedTxs(t, 4)
+	cache := NewSigCache(3)
+
+	assert.Nil(t, VerifyTransactions(txs[:2], cache))
+	assert.True(t, cache.Contains(txs[0]))
+	assert.True(t, cache.Contains(txs[1]))
+	assert.False(t, cache.Contains(txs[2]))
+
+	// the oldest entry is evicted
+	assert.Nil(t, VerifyTransactions(txs[2:], cache))
+	assert.Equal(t, 3, cache.Len())
+	assert.False(t, cache.Contains(txs[0]))
+	assert.True(t, cache.Contains(txs[3]))
+}
+
+func TestSigCacheChecksSignature(t *testing.T) {
+	tx := signedTxs(t, 1)[0]
+	cache := NewSigCache(1)
+	assert.Nil(t, VerifyTransactions([]*Transaction{tx}, cache))
+
+	// same hash, but a signature that was not verified
+	tx.Signature = &crypto.Signature{Scheme: tx.Signature.Scheme, R: big.NewInt(1), S: big.NewInt(2)}
+	assert.False(t, cache.Contains(tx))
+	assert.NotNil(t, VerifyTransactions([]*Transaction{tx}, cache))
+}
+
+func TestSigCacheMissesChangedTx(t *testing.T) {
+	tx := signedTxs(t, 1)[0]
+	cache := NewSigCache(1)
+	assert.Nil(t, VerifyTransactions([]*Transaction{tx}, cache))
+
+	tx.Value = 1
+	assert.False(t, cache.Contains(tx))
+	assert.NotNil(t, VerifyTransactions([]*Transaction{tx}, cache))
+}
+
+func TestBlockchainVerifyTransactionCaches(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	tx := signedTxs(t, 1)[0]
+
+	assert.Nil(t, bc.VerifyTransaction(tx))
+	assert.True(t, bc.sigCache.Contains(tx))
+}
+
+func BenchmarkVerifyTransactions(b *testing.B) {
+	txs := signedTxs(b, 256)
+
+	runWorkers := func(workers int) func(b *testing.B) {
+		return func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := verifyTransactions(txs, nil, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	b.Run("sequential", runWorkers(1))
+	b.Run(fmt.Sprintf("parallel-%d", runtime.GOMAXPROCS(0)), runWorkers(runtime.GOMAXPROCS(0)))
+
+	b.Run("cached", func(b *testing.B) {
+		cache := NewSigCache(len(txs))
+		for _, tx := range txs {
+			cache.Add(tx)
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := VerifyTransactions(txs, cache); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func signedTxs(tb testing.TB, n int) []*Transaction {
+	privKey := crypto.GeneratePrivateKey()
+
+	txs := make([]*Transaction, n)
+	for i := range txs {
+		txs[i] = &Transaction{Data: []byte("foobar"), Nonce: uint64(i)}
+		if err := txs[i].Sign(privKey); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	return txs
+}
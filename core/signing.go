@@ -0,0 +1,25 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Signatures are made over a type tag, the chain ID and the canonical
+// encoding of the signed object. The tag keeps a block signature
+// from being valid as a transaction signature and the chain ID keeps
+// signatures of one network from being valid on another.
+const (
+	blockSigningTag = "bcbasic/block"
+	txSigningTag    = "bcbasic/tx"
+)
+
+func signingMessage(tag string, chainID uint64, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(byte(len(tag)))
+	buf.WriteString(tag)
+	binary.Write(buf, binary.BigEndian, chainID)
+	buf.Write(data)
+
+	return buf.Bytes()
+}
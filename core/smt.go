@@ -0,0 +1,145 @@
+package core
+
+import (
+	"crypto/sha256"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+const smtDepth = 256
+
+// SparseMerkleTree is a binary merkle tree with a leaf for every possible 256
+// bit path. Empty subtrees hash to the zero hash, so only the non empty nodes
+// need to be stored and the root of an empty tree is the zero hash. Every
+// node is stored, so an update rehashes just the nodes on its path and the
+// root and the siblings of a path are lookups.
+type SparseMerkleTree struct {
+	nodes map[smtNodeKey]types.Hash
+}
+
+// smtNodeKey identifies the node at depth whose subtree holds the paths
+// starting with prefix. The bits of prefix from depth on are zero; the root
+// is at depth 0 and the leaves at smtDepth.
+type smtNodeKey struct {
+	depth  int
+	prefix types.Hash
+}
+
+func NewSparseMerkleTree() *SparseMerkleTree {
+	return &SparseMerkleTree{
+		nodes: make(map[smtNodeKey]types.Hash),
+	}
+}
+
+// Update sets the leaf at path to leaf.
+func (t *SparseMerkleTree) Update(path, leaf types.Hash) {
+	t.setNode(smtDepth, path, leaf)
+	t.rehashPath(path)
+}
+
+// Remove empties the leaf at path.
+func (t *SparseMerkleTree) Remove(path types.Hash) {
+	t.setNode(smtDepth, path, types.Hash{})
+	t.rehashPath(path)
+}
+
+func (t *SparseMerkleTree) Root() types.Hash {
+	return t.node(0, types.Hash{})
+}
+
+// Siblings returns the sibling hashes on the path from the root down to the
+// leaf at path, ordered from the root downwards.
+func (t *SparseMerkleTree) Siblings(path types.Hash) []types.Hash {
+	siblings := make([]types.Hash, smtDepth)
+	for depth := 0; depth < smtDepth; depth++ {
+		siblings[depth] = t.node(depth+1, flipBit(pathPrefix(path, depth+1), depth))
+	}
+
+	return siblings
+}
+
+// rehashPath recomputes the nodes above the leaf at path, bottom up.
+func (t *SparseMerkleTree) rehashPath(path types.Hash) {
+	hash := t.node(smtDepth, path)
+	for depth := smtDepth - 1; depth >= 0; depth-- {
+		sibling := t.node(depth+1, flipBit(pathPrefix(path, depth+1), depth))
+		if pathBit(path, depth) == 0 {
+			hash = smtNodeHash(hash, sibling)
+		} else {
+			hash = smtNodeHash(sibling, hash)
+		}
+		t.setNode(depth, path, hash)
+	}
+}
+
+func (t *SparseMerkleTree) node(depth int, prefix types.Hash) types.Hash {
+	return t.nodes[smtNodeKey{depth: depth, prefix: prefix}]
+}
+
+// setNode stores the node at depth on path, empty nodes are dropped.
+func (t *SparseMerkleTree) setNode(depth int, path, hash types.Hash) {
+	key := smtNodeKey{depth: depth, prefix: pathPrefix(path, depth)}
+	if hash.IsZero() {
+		delete(t.nodes, key)
+	} else {
+		t.nodes[key] = hash
+	}
+}
+
+// pathPrefix returns path with every bit from depth on cleared.
+func pathPrefix(path types.Hash, depth int) types.Hash {
+	if depth >= smtDepth {
+		return path
+	}
+
+	prefix := types.Hash{}
+	copy(prefix[:depth/8], path[:depth/8])
+	if rem := depth % 8; rem > 0 {
+		prefix[depth/8] = path[depth/8] & (0xff << (8 - uint(rem)))
+	}
+
+	return prefix
+}
+
+func flipBit(path types.Hash, depth int) types.Hash {
+	path[depth/8] ^= 1 << (7 - uint(depth%8))
+	return path
+}
+
+// smtRootFromLeaf hashes leaf up to the given depth using the supplied
+// siblings, which are indexed by depth.
+func smtRootFromLeaf(path, leaf types.Hash, siblings []types.Hash, depth int) types.Hash {
+	hash := leaf
+	for d := smtDepth - 1; d >= depth; d-- {
+		if pathBit(path, d) == 0 {
+			hash = smtNodeHash(hash, siblings[d])
+		} else {
+			hash = smtNodeHash(siblings[d], hash)
+		}
+	}
+
+	return hash
+}
+
+func pathBit(path types.Hash, depth int) byte {
+	return (path[depth/8] >> (7 - uint(depth%8))) & 1
+}
+
+func smtLeafHash(path types.Hash, value []byte) types.Hash {
+	valueHash := sha256.Sum256(value)
+
+	buf := make([]byte, 0, 1+len(path)+len(valueHash))
+	buf = append(buf, merkleLeafPrefix)
+	buf = append(buf, path[:]...)
+	buf = append(buf, valueHash[:]...)
+
+	return types.Hash(sha256.Sum256(buf))
+}
+
+func smtNodeHash(left, right types.Hash) types.Hash {
+	if left.IsZero() && right.IsZero() {
+		return types.Hash{}
+	}
+
+	return merkleNodeHash(left, right)
+}
@@ -1,31 +1,244 @@
 package core
 
-import "fmt"
+import (
+	"crypto/sha256"
+	"fmt"
 
+	"github.com/dbkbali/bcbasic/types"
+)
+
+// stateChange records the value a key had before it was modified.
+type stateChange struct {
+	key     string
+	prev    []byte
+	existed bool
+}
+
+// Keys are namespaced so contracts can not write to accounts.
+const (
+	contractNamespace byte = 0x00
+	accountNamespace  byte = 0x01
+)
+
+// State holds the contract key value store and the accounts. Every key is a
+// leaf of a sparse merkle tree at the path sha256(key), so the whole state is
+// committed to by Root and single keys can be proven with GetProof.
 type State struct {
 	data map[string][]byte
+	tree *SparseMerkleTree
+
+	// journal of the changes made since the last Commit
+	journal []stateChange
+	// live snapshots, oldest first. Ids are never reused, so an id from
+	// before a Commit or a revert to an older snapshot is rejected.
+	snapshots    []snapshot
+	nextSnapshot int
+}
+
+// snapshot maps a snapshot id to the journal length when it was taken.
+type snapshot struct {
+	id         int
+	journalLen int
+}
+
+// StateProof proves that a key has a value in the state, or that it is absent
+// when Exists is false. Key is the key as stored in the tree, prefixed with its
+// namespace. Only the non empty siblings are included, Bitmap marks at which
+// depths they belong.
+type StateProof struct {
+	Key      []byte
+	Value    []byte
+	Exists   bool
+	Bitmap   [smtDepth / 8]byte
+	Siblings []types.Hash
 }
 
 func NewState() *State {
 	return &State{
 		data: make(map[string][]byte),
+		tree: NewSparseMerkleTree(),
 	}
 }
 
 func (s *State) Put(k, v []byte) error {
-	s.data[string(k)] = v
+	key := namespacedKey(contractNamespace, k)
+	s.record(key)
+	s.set(key, v)
 	return nil
 }
 
 func (s *State) Delete(k []byte) error {
-	delete(s.data, string(k))
+	key := namespacedKey(contractNamespace, k)
+	s.record(key)
+	s.remove(key)
 	return nil
 }
 
 func (s *State) Get(k []byte) ([]byte, error) {
-	value, ok := s.data[string(k)]
+	value, ok := s.data[namespacedKey(contractNamespace, k)]
 	if !ok {
 		return nil, fmt.Errorf("key %s not found", string(k))
 	}
 	return value, nil
 }
+
+// Root returns the root of the state tree. The root of an empty state is the
+// zero hash.
+func (s *State) Root() types.Hash {
+	return s.tree.Root()
+}
+
+// GetProof returns a proof of the value of the contract key k, or of its
+// absence, against the current root.
+func (s *State) GetProof(k []byte) (*StateProof, error) {
+	return s.proof(namespacedKey(contractNamespace, k)), nil
+}
+
+func (s *State) proof(key string) *StateProof {
+	value, ok := s.data[key]
+
+	proof := &StateProof{
+		Key:      []byte(key),
+		Value:    value,
+		Exists:   ok,
+		Siblings: []types.Hash{},
+	}
+
+	for depth, sibling := range s.tree.Siblings(statePath([]byte(key))) {
+		if sibling.IsZero() {
+			continue
+		}
+		proof.Bitmap[depth/8] |= 1 << (7 - uint(depth%8))
+		proof.Siblings = append(proof.Siblings, sibling)
+	}
+
+	return proof
+}
+
+// Verify reports whether the proof is valid against root.
+func (p *StateProof) Verify(root types.Hash) bool {
+	var (
+		path     = statePath(p.Key)
+		siblings = make([]types.Hash, smtDepth)
+		used     = 0
+	)
+
+	for depth := 0; depth < smtDepth; depth++ {
+		if p.Bitmap[depth/8]&(1<<(7-uint(depth%8))) == 0 {
+			continue
+		}
+		if used >= len(p.Siblings) {
+			return false
+		}
+		siblings[depth] = p.Siblings[used]
+		used++
+	}
+	if used != len(p.Siblings) {
+		return false
+	}
+
+	leaf := types.Hash{}
+	if p.Exists {
+		leaf = smtLeafHash(path, p.Value)
+	}
+
+	return smtRootFromLeaf(path, leaf, siblings, 0) == root
+}
+
+func (s *State) set(k string, v []byte) {
+	s.data[k] = v
+	path := statePath([]byte(k))
+	s.tree.Update(path, smtLeafHash(path, v))
+}
+
+func (s *State) remove(k string) {
+	delete(s.data, k)
+	s.tree.Remove(statePath([]byte(k)))
+}
+
+func (s *State) record(k string) {
+	prev, ok := s.data[k]
+	s.journal = append(s.journal, stateChange{
+		key:     k,
+		prev:    prev,
+		existed: ok,
+	})
+}
+
+// Snapshot returns an identifier of the current state that can later be
+// passed to RevertToSnapshot. Snapshots can be nested.
+func (s *State) Snapshot() int {
+	id := s.nextSnapshot
+	s.nextSnapshot++
+	s.snapshots = append(s.snapshots, snapshot{id: id, journalLen: len(s.journal)})
+
+	return id
+}
+
+// RevertToSnapshot undoes every change made since the snapshot was taken.
+// Snapshots taken after it become invalid.
+func (s *State) RevertToSnapshot(id int) error {
+	i, err := s.findSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	n := s.snapshots[i].journalLen
+	s.undo(s.journal[n:])
+	s.journal = s.journal[:n]
+	s.snapshots = s.snapshots[:i+1]
+
+	return nil
+}
+
+// Commit makes the changes permanent by discarding the journal. Snapshots
+// taken before the commit become invalid.
+func (s *State) Commit() {
+	s.journal = nil
+	s.snapshots = nil
+}
+
+// changesSince returns the changes made since the snapshot was taken.
+func (s *State) changesSince(id int) ([]stateChange, error) {
+	i, err := s.findSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+
+	n := s.snapshots[i].journalLen
+	changes := make([]stateChange, len(s.journal)-n)
+	copy(changes, s.journal[n:])
+
+	return changes, nil
+}
+
+func (s *State) findSnapshot(id int) (int, error) {
+	for i := len(s.snapshots) - 1; i >= 0; i-- {
+		if s.snapshots[i].id == id {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid state snapshot [%d]", id)
+}
+
+// undo reverts the given changes, newest first. The reverted changes are not
+// journaled.
+func (s *State) undo(changes []stateChange) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		if change.existed {
+			s.set(change.key, change.prev)
+		} else {
+			s.remove(change.key)
+		}
+	}
+}
+
+func namespacedKey(namespace byte, k []byte) string {
+	return string(append([]byte{namespace}, k...))
+}
+
+func statePath(k []byte) types.Hash {
+	return types.Hash(sha256.Sum256(k))
+}
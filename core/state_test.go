@@ -0,0 +1,152 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dbkbali/bcbasic/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateRootEmpty(t *testing.T) {
+	s := NewState()
+	assert.Equal(t, types.Hash{}, s.Root())
+
+	assert.Nil(t, s.Put([]byte("foo"), []byte("bar")))
+	assert.False(t, s.Root().IsZero())
+
+	assert.Nil(t, s.Delete([]byte("foo")))
+	assert.Equal(t, types.Hash{}, s.Root())
+	// no interior nodes are left behind
+	assert.Empty(t, s.tree.nodes)
+}
+
+func TestStateRootIndependentOfOrder(t *testing.T) {
+	a := NewState()
+	b := NewState()
+	n := 50
+
+	for i := 0; i < n; i++ {
+		assert.Nil(t, a.Put([]byte(fmt.Sprintf("key_%d", i)), []byte{byte(i)}))
+	}
+	for i := n - 1; i >= 0; i-- {
+		assert.Nil(t, b.Put([]byte(fmt.Sprintf("key_%d", i)), []byte{byte(i)}))
+	}
+	assert.Equal(t, a.Root(), b.Root())
+
+	assert.Nil(t, b.Put([]byte("key_0"), []byte{0xff}))
+	assert.NotEqual(t, a.Root(), b.Root())
+}
+
+func TestStateMembershipProof(t *testing.T) {
+	s := NewState()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, s.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	root := s.Root()
+
+	for i := 0; i < 20; i++ {
+		proof, err := s.GetProof([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, proof.Exists)
+		assert.True(t, proof.Verify(root))
+
+		proof.Value = []byte("forged")
+		assert.False(t, proof.Verify(root))
+	}
+}
+
+func TestStateNonMembershipProof(t *testing.T) {
+	s := NewState()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, s.Put([]byte(fmt.Sprintf("key_%d", i)), []byte{byte(i)}))
+	}
+	root := s.Root()
+
+	proof, err := s.GetProof([]byte("missing"))
+	assert.Nil(t, err)
+	assert.False(t, proof.Exists)
+	assert.True(t, proof.Verify(root))
+
+	// a non membership proof can not be built for a key that is present
+	proof, err = s.GetProof([]byte("key_3"))
+	assert.Nil(t, err)
+	proof.Exists = false
+	assert.False(t, proof.Verify(root))
+}
+
+func TestStateProofEmptyState(t *testing.T) {
+	s := NewState()
+
+	proof, err := s.GetProof([]byte("foo"))
+	assert.Nil(t, err)
+	assert.Len(t, proof.Siblings, 0)
+	assert.True(t, proof.Verify(types.Hash{}))
+}
+
+func TestStateUndoRestoresRoot(t *testing.T) {
+	s := NewState()
+	assert.Nil(t, s.Put([]byte("foo"), []byte("bar")))
+	root := s.Root()
+
+	snap := s.Snapshot()
+	assert.Nil(t, s.Put([]byte("foo"), []byte("baz")))
+	assert.Nil(t, s.Put([]byte("new"), []byte("value")))
+	assert.Nil(t, s.Delete([]byte("foo")))
+	changes, err := s.changesSince(snap)
+	assert.Nil(t, err)
+	s.undo(changes)
+
+	assert.Equal(t, root, s.Root())
+	value, err := s.Get([]byte("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bar"), value)
+}
+
+func TestStateNestedSnapshots(t *testing.T) {
+	s := NewState()
+	assert.Nil(t, s.Put([]byte("a"), []byte{1}))
+	outer := s.Snapshot()
+	rootOuter := s.Root()
+
+	assert.Nil(t, s.Put([]byte("b"), []byte{2}))
+	inner := s.Snapshot()
+	rootInner := s.Root()
+
+	assert.Nil(t, s.Put([]byte("a"), []byte{3}))
+	assert.Nil(t, s.Delete([]byte("b")))
+
+	assert.Nil(t, s.RevertToSnapshot(inner))
+	assert.Equal(t, rootInner, s.Root())
+	value, err := s.Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2}, value)
+
+	assert.Nil(t, s.RevertToSnapshot(outer))
+	assert.Equal(t, rootOuter, s.Root())
+	_, err = s.Get([]byte("b"))
+	assert.NotNil(t, err)
+
+	// the inner snapshot is gone once an outer one was reverted
+	assert.Nil(t, s.Put([]byte("c"), []byte{4}))
+	assert.Nil(t, s.Put([]byte("d"), []byte{5}))
+	assert.NotNil(t, s.RevertToSnapshot(inner))
+}
+
+func TestStateCommit(t *testing.T) {
+	s := NewState()
+	snap := s.Snapshot()
+	assert.Nil(t, s.Put([]byte("a"), []byte{1}))
+	s.Commit()
+
+	// a snapshot from before the commit is stale, even once the journal has
+	// grown past it again
+	assert.Nil(t, s.Put([]byte("b"), []byte{2}))
+	assert.NotNil(t, s.RevertToSnapshot(snap))
+	value, err := s.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1}, value)
+	value, err = s.Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2}, value)
+}
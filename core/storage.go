@@ -1,16 +1,92 @@
 package core
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+var ErrBlockNotStored = errors.New("block not found in storage")
+
+// Storage persists every block put into it, side branches included, so there
+// is no lookup by height: which block is canonical at a height is up to the
+// Blockchain.
 type Storage interface {
 	Put(*Block) error
+	GetByHash(hash types.Hash) (*Block, error)
+	Has(hash types.Hash) bool
+	// Iterate calls fn for every stored block in the order they were put.
+	// Iteration stops at the first error returned by fn.
+	Iterate(fn func(*Block) error) error
+	Close() error
 }
 
 type MemoryStore struct {
+	lock   sync.RWMutex
+	blocks []*Block
+	byHash map[types.Hash]*Block
 }
 
 func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{}
+	return &MemoryStore{
+		blocks: []*Block{},
+		byHash: make(map[types.Hash]*Block),
+	}
+}
+
+func (s *MemoryStore) Put(b *Block) error {
+	hash := b.Hash(BlockHasher{})
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.byHash[hash]; ok {
+		return nil
+	}
+
+	s.blocks = append(s.blocks, b)
+	s.byHash[hash] = b
+
+	return nil
+}
+
+func (s *MemoryStore) GetByHash(hash types.Hash) (*Block, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	b, ok := s.byHash[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: hash [%s]", ErrBlockNotStored, hash)
+	}
+
+	return b, nil
+}
+
+func (s *MemoryStore) Has(hash types.Hash) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.byHash[hash]
+	return ok
+}
+
+func (s *MemoryStore) Iterate(fn func(*Block) error) error {
+	s.lock.RLock()
+	blocks := make([]*Block, len(s.blocks))
+	copy(blocks, s.blocks)
+	s.lock.RUnlock()
+
+	for _, b := range blocks {
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (s *MemoryStore) Put(*Block) error {
+func (s *MemoryStore) Close() error {
 	return nil
 }
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dbkbali/bcbasic/types"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorePutGet(t *testing.T) {
+	s := NewMemoryStore()
+	b := randomBlock(t, 0, types.Hash{})
+
+	assert.Nil(t, s.Put(b))
+	assert.True(t, s.Has(b.Hash(BlockHasher{})))
+
+	got, err := s.GetByHash(b.Hash(BlockHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, b, got)
+
+	_, err = s.GetByHash(types.Hash{})
+	assert.ErrorIs(t, err, ErrBlockNotStored)
+}
+
+func TestFileStorePutGet(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	defer s.Close()
+
+	blocks := randomChain(t, 10)
+	for _, b := range blocks {
+		assert.Nil(t, s.Put(b))
+	}
+
+	for _, b := range blocks {
+		hash := b.Hash(BlockHasher{})
+		assert.True(t, s.Has(hash))
+
+		byHash, err := s.GetByHash(hash)
+		assert.Nil(t, err)
+		assert.Equal(t, b.Height, byHash.Height)
+	}
+
+	_, err = s.GetByHash(types.Hash{})
+	assert.ErrorIs(t, err, ErrBlockNotStored)
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	blocks := randomChain(t, 20)
+
+	// tiny segments force a rollover on every put
+	s, err := NewFileStoreWithSegmentSize(dir, 64)
+	assert.Nil(t, err)
+	for _, b := range blocks {
+		assert.Nil(t, s.Put(b))
+	}
+	assert.Nil(t, s.Close())
+
+	s, err = NewFileStoreWithSegmentSize(dir, 64)
+	assert.Nil(t, err)
+	defer s.Close()
+
+	i := 0
+	assert.Nil(t, s.Iterate(func(b *Block) error {
+		assert.Equal(t, blocks[i].Hash(BlockHasher{}), b.Hash(BlockHasher{}))
+		i++
+		return nil
+	}))
+	assert.Equal(t, len(blocks), i)
+}
+
+func TestFileStoreClosed(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+
+	b := randomBlock(t, 0, types.Hash{})
+	assert.Nil(t, s.Put(b))
+	assert.Nil(t, s.Close())
+	assert.Nil(t, s.Close())
+
+	assert.ErrorIs(t, s.Put(randomBlock(t, 1, b.Hash(BlockHasher{}))), ErrClosed)
+	_, err = s.GetByHash(b.Hash(BlockHasher{}))
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, s.Iterate(func(*Block) error { return nil }), ErrClosed)
+}
+
+func TestFileStoreTruncatesTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	blocks := randomChain(t, 3)
+
+	s, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	for _, b := range blocks {
+		assert.Nil(t, s.Put(b))
+	}
+	assert.Nil(t, s.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(0)), os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte{0x00, 0x00, 0x10})
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	s, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	defer s.Close()
+
+	next := randomBlock(t, 3, blocks[2].Hash(BlockHasher{}))
+	assert.Nil(t, s.Put(next))
+
+	b, err := s.GetByHash(next.Hash(BlockHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, next.Hash(BlockHasher{}), b.Hash(BlockHasher{}))
+}
+
+func TestBlockchainLoadFromFileStore(t *testing.T) {
+	dir := t.TempDir()
+	genesis := randomGenesis(t)
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+
+	bc, err := NewBlockchainWithStorage(log.NewNopLogger(), store, genesis)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, bc.AddBlock(randomBlockOnTip(t, bc)))
+	}
+	assert.Nil(t, store.Close())
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	reloaded, err := NewBlockchainWithStorage(log.NewNopLogger(), store, genesis)
+	assert.Nil(t, err)
+	assert.Equal(t, bc.Height(), reloaded.Height())
+
+	for i := uint32(0); i <= bc.Height(); i++ {
+		want, err := bc.GetHeader(i)
+		assert.Nil(t, err)
+		got, err := reloaded.GetHeader(i)
+		assert.Nil(t, err)
+		assert.Equal(t, BlockHasher{}.Hash(want), BlockHasher{}.Hash(got))
+	}
+
+	// a different genesis must not silently adopt the stored chain
+	_, err = NewBlockchainWithStorage(log.NewNopLogger(), store, randomGenesis(t))
+	assert.NotNil(t, err)
+}
+
+func randomChain(t *testing.T, n int) []*Block {
+	blocks := []*Block{randomBlock(t, 0, types.Hash{})}
+	for i := 1; i < n; i++ {
+		prev := blocks[i-1]
+		blocks = append(blocks, randomBlock(t, uint32(i), prev.Hash(BlockHasher{})))
+	}
+
+	return blocks
+}
+
+// failingStore refuses every block after the genesis.
+type failingStore struct {
+	*MemoryStore
+}
+
+func (s failingStore) Put(b *Block) error {
+	if b.Height > 0 {
+		return fmt.Errorf("disk full")
+	}
+
+	return s.MemoryStore.Put(b)
+}
+
+func TestBlockchainPersistsBeforeSwitchingTip(t *testing.T) {
+	bc, err := NewBlockchainWithStorage(log.NewNopLogger(), failingStore{NewMemoryStore()}, randomGenesis(t))
+	assert.Nil(t, err)
+
+	block := randomBlockOnTip(t, bc)
+	assert.NotNil(t, bc.AddBlock(block))
+	assert.Equal(t, uint32(0), bc.Height())
+	assert.False(t, bc.HasBlockHash(block.Hash(BlockHasher{})))
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/dbkbali/bcbasic/crypto"
@@ -9,10 +10,25 @@ import (
 
 type Transaction struct {
 	Data []byte
+	// To and Value transfer native tokens from the sender to To.
+	To    types.Address
+	Value uint64
+	// Nonce is the number of transactions the sender sent before this one. It
+	// stops a signed transaction from being included more than once.
+	Nonce uint64
+	// ChainID is the network the transaction is meant for.
+	ChainID uint64
 
 	From      crypto.PublicKey
 	Signature *crypto.Signature
-	hash      types.Hash
+	// Multisig is set instead of From when the sender is a multisig account,
+	// its keys sign into MultisigSignatures instead of Signature.
+	Multisig           *MultisigAccount
+	MultisigSignatures []*MultisigSignature
+
+	// hash caches the TxHasher hash. Signing and decoding reset it, the
+	// fields must not be changed otherwise once the transaction is hashed.
+	hash types.Hash
 
 	// time is when the transaction was added to the pool
 	firstSeen int64
@@ -24,39 +40,127 @@ func NewTransaction(data []byte) *Transaction {
 	}
 }
 
+func NewTransferTransaction(to types.Address, value uint64) *Transaction {
+	return &Transaction{
+		To:    to,
+		Value: value,
+	}
+}
+
+// IsTransfer reports whether the transaction moves native tokens.
+func (tx *Transaction) IsTransfer() bool {
+	return tx.Value > 0
+}
+
+// Hash returns the hash of the transaction computed by hasher. The TxHasher
+// hash is computed once and cached.
 func (tx *Transaction) Hash(hasher Hasher[*Transaction]) types.Hash {
-	if tx.hash.IsZero() {
+	if _, ok := hasher.(TxHasher); !ok {
 		return hasher.Hash(tx)
 	}
 
+	if tx.hash.IsZero() {
+		tx.hash = hasher.Hash(tx)
+	}
+
 	return tx.hash
 }
 
-func (tx *Transaction) Sign(privKey crypto.PrivateKey) error {
-	sig, err := privKey.Sign(tx.Data)
+func (tx *Transaction) Sign(signer crypto.Signer) error {
+	sig, err := signer.Sign(tx.signingBytes())
 	if err != nil {
 		return err
 	}
 
-	tx.From = privKey.PublicKey()
+	tx.From = signer.PublicKey()
 	tx.Signature = sig
+	tx.hash = types.Hash{}
 
 	return nil
 }
 
+// SignMultisig adds the signature of a key of the multisig account of the
+// transaction.
+func (tx *Transaction) SignMultisig(signer crypto.Signer) error {
+	if tx.Multisig == nil {
+		return fmt.Errorf("%w: transaction has no multisig account", ErrInvalidMultisig)
+	}
+
+	index, err := tx.Multisig.KeyIndex(signer.PublicKey())
+	if err != nil {
+		return err
+	}
+
+	sig, err := signer.Sign(tx.signingBytes())
+	if err != nil {
+		return err
+	}
+
+	tx.MultisigSignatures = append(tx.MultisigSignatures, &MultisigSignature{
+		KeyIndex:  index,
+		Signature: sig,
+	})
+	tx.hash = types.Hash{}
+
+	return nil
+}
+
+// Sender returns the address of the account the transaction is sent from.
+func (tx *Transaction) Sender() types.Address {
+	if tx.Multisig != nil {
+		return tx.Multisig.Address()
+	}
+
+	return tx.From.Address()
+}
+
 func (tx *Transaction) Verify() error {
+	if tx.Multisig != nil {
+		if len(tx.From) > 0 || tx.Signature != nil {
+			return fmt.Errorf("%w: multisig transaction with a single signer", ErrInvalidMultisig)
+		}
+		return tx.Multisig.Verify(tx.MultisigSignatures, tx.signingBytes())
+	}
+
 	if tx.Signature == nil {
 		return fmt.Errorf("no signature")
 	}
 
-	if !tx.Signature.Verify(tx.From, tx.Data) {
+	if !tx.Signature.Verify(tx.From, tx.signingBytes()) {
 		return fmt.Errorf("invalid signature")
 	}
 
 	return nil
 }
 
+// signingBytes returns the message the sender signs.
+func (tx *Transaction) signingBytes() []byte {
+	return signingMessage(txSigningTag, tx.ChainID, tx.signedFields())
+}
+
+// hashBytes returns the signed fields followed by the sender, which is what
+// the transaction hash commits to.
+func (tx *Transaction) hashBytes() []byte {
+	buf := &bytes.Buffer{}
+	bw := &binaryWriter{w: buf}
+	bw.txFields(tx)
+	bw.bytes(tx.From)
+
+	return buf.Bytes()
+}
+
+// signedFields returns the canonical encoding of the fields covered by the
+// signature.
+func (tx *Transaction) signedFields() []byte {
+	buf := &bytes.Buffer{}
+	bw := &binaryWriter{w: buf}
+	bw.txFields(tx)
+
+	return buf.Bytes()
+}
+
 func (tx *Transaction) Decode(dec Decoder[*Transaction]) error {
+	tx.hash = types.Hash{}
 	return dec.Decode(tx)
 }
 
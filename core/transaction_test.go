@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/dbkbali/bcbasic/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -54,6 +55,67 @@ func TestTxEncodeDecode(t *testing.T) {
 	assert.Equal(t, tx, decTx)
 }
 
+func TestTxHashCoversSender(t *testing.T) {
+	a := NewTransaction([]byte("foobar"))
+	assert.Nil(t, a.Sign(crypto.GeneratePrivateKey()))
+	b := NewTransaction([]byte("foobar"))
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+
+	assert.NotEqual(t, a.Hash(TxHasher{}), b.Hash(TxHasher{}))
+}
+
+type constTxHasher struct{}
+
+func (constTxHasher) Hash(*Transaction) types.Hash { return types.Hash{1} }
+
+func TestTxHashUsesHasher(t *testing.T) {
+	tx := NewTransaction([]byte("foobar"))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+
+	hash := tx.Hash(TxHasher{})
+	// only the TxHasher hash is cached
+	assert.Equal(t, types.Hash{1}, tx.Hash(constTxHasher{}))
+	assert.Equal(t, hash, tx.Hash(TxHasher{}))
+}
+
+func TestTxHashCacheReset(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	tx := NewTransaction([]byte("foobar"))
+	assert.Nil(t, tx.Sign(privKey))
+
+	hash := tx.Hash(TxHasher{})
+	assert.Equal(t, hash, tx.hash)
+
+	// signing after a change resets the cache
+	tx.Nonce = 1
+	assert.Nil(t, tx.Sign(privKey))
+	assert.NotEqual(t, hash, tx.Hash(TxHasher{}))
+	assert.Equal(t, TxHasher{}.Hash(tx), tx.Hash(TxHasher{}))
+
+	// so does decoding into the transaction
+	other := NewTransaction([]byte("other"))
+	assert.Nil(t, other.Sign(privKey))
+	buf := &bytes.Buffer{}
+	assert.Nil(t, other.Encode(NewBinaryTxEncoder(buf)))
+	assert.Nil(t, tx.Decode(NewBinaryTxDecoder(buf)))
+	assert.Equal(t, other.Hash(TxHasher{}), tx.Hash(TxHasher{}))
+
+	// and adding a multisig signature
+	key := crypto.GeneratePrivateKey()
+	m, err := NewMultisigAccount(1, key.PublicKey())
+	assert.Nil(t, err)
+	multi := NewTransaction([]byte("foo"))
+	multi.Multisig = m
+	assert.Nil(t, multi.SignMultisig(key))
+	hash = multi.Hash(TxHasher{})
+
+	multi.Data = []byte("bar")
+	multi.MultisigSignatures = nil
+	assert.Nil(t, multi.SignMultisig(key))
+	assert.NotEqual(t, hash, multi.Hash(TxHasher{}))
+	assert.Equal(t, TxHasher{}.Hash(multi), multi.Hash(TxHasher{}))
+}
+
 func randomTxWithSignature(t *testing.T) *Transaction {
 	privKey := crypto.GeneratePrivateKey()
 	tx := &Transaction{
@@ -64,3 +126,33 @@ func randomTxWithSignature(t *testing.T) *Transaction {
 
 	return tx
 }
+
+func TestTxSignatureBoundToChainID(t *testing.T) {
+	tx := NewTransaction([]byte("foobar"))
+	tx.ChainID = 1
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, tx.Verify())
+
+	tx.ChainID = 2
+	assert.NotNil(t, tx.Verify())
+}
+
+func TestTxSignatureSchemes(t *testing.T) {
+	signers := []crypto.Signer{
+		crypto.GeneratePrivateKey(),
+		crypto.GenerateEd25519PrivateKey(),
+	}
+
+	for _, signer := range signers {
+		tx := NewTransaction([]byte("foobar"))
+		assert.Nil(t, tx.Sign(signer))
+		assert.Nil(t, tx.Verify())
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, tx.Encode(NewBinaryTxEncoder(buf)))
+		decoded := new(Transaction)
+		assert.Nil(t, decoded.Decode(NewBinaryTxDecoder(buf)))
+		assert.Equal(t, signer.PublicKey().Scheme(), decoded.Signature.Scheme)
+		assert.Nil(t, decoded.Verify())
+	}
+}
@@ -3,12 +3,32 @@ package core
 import (
 	"errors"
 	"fmt"
+
+	"github.com/dbkbali/bcbasic/types"
+)
+
+var (
+	ErrBlockKnown        = errors.New("block already known")
+	ErrUnknownParent     = errors.New("unknown parent block")
+	ErrStateRootMismatch = errors.New("state root mismatch")
+	ErrNonceTooLow       = errors.New("nonce too low")
+	ErrNonceTooHigh      = errors.New("nonce too high")
+	ErrChainIDMismatch   = errors.New("chain id mismatch")
+	ErrBlockTooLarge     = errors.New("block too large")
 )
 
-var ErrBlockKnown = errors.New("block already known")
+// MaxBlockSize bounds the binary encoding of a block, which keeps every valid
+// block small enough to be sent to peers.
+const MaxBlockSize = 1 << 24
+
+// blockOverhead is room for the header, validator key and signature of a
+// block when transactions are packed into it.
+const blockOverhead = 1 << 10
 
 type Validator interface {
 	ValidateBlock(b *Block) error
+	// ValidateState checks the state that results from executing b.
+	ValidateState(b *Block, state *State) error
 }
 
 type BlockValidator struct {
@@ -21,32 +41,86 @@ func NewBlockValidator(bc *Blockchain) *BlockValidator {
 	}
 }
 
+// ValidateBlock checks that b can be added to the block tree. Blocks at a
+// height that is already taken are accepted as long as they extend a known
+// block, the fork choice rule decides which branch becomes canonical.
 func (v *BlockValidator) ValidateBlock(b *Block) error {
-	// validate block header
-	// validate block transactions
-	// validate block hash
-	if v.bc.HasBlock(b.Height) {
-		// return fmt.Errorf("block [%d] already exists with hash [%x]", b.Height, b.Hash(BlockHasher{}))
+	hash := b.Hash(BlockHasher{})
+	if v.bc.HasBlockHash(hash) {
 		return ErrBlockKnown
 	}
 
-	if b.Height != v.bc.Height()+1 {
-		return fmt.Errorf("block height [%d] is too high - current height [%d] - block %s", b.Height, v.bc.Height()+1, b.Hash(BlockHasher{}))
+	prevHeader, err := v.bc.GetHeaderByHash(b.PrevBlockHash)
+	if err != nil {
+		return fmt.Errorf("%w: block [%s] prev hash [%s]", ErrUnknownParent, hash, b.PrevBlockHash)
 	}
 
-	prevHeader, err := v.bc.GetHeader(b.Height - 1)
-	if err != nil {
-		return err
+	if size := b.encodedSize(); size > MaxBlockSize {
+		return fmt.Errorf("%w: block [%s] has %d bytes, max %d", ErrBlockTooLarge, hash, size, MaxBlockSize)
 	}
 
-	hash := BlockHasher{}.Hash(prevHeader)
-	if hash != b.PrevBlockHash {
-		return fmt.Errorf("block prev hash [%x] does not match prev header hash [%x]", b.PrevBlockHash, hash)
+	if b.ChainID != v.bc.ChainID() {
+		return fmt.Errorf("%w: block [%s] chain id [%d] expected [%d]", ErrChainIDMismatch, hash, b.ChainID, v.bc.ChainID())
 	}
 
-	if err := b.Verify(); err != nil {
+	if b.Height != prevHeader.Height+1 {
+		return fmt.Errorf("block [%s] height [%d] does not follow parent height [%d]", hash, b.Height, prevHeader.Height)
+	}
+
+	if err := b.VerifyCached(v.bc.sigCache); err != nil {
 		return err
 	}
 
+	// the nonces of blocks on side branches are checked when they are executed
+	if b.PrevBlockHash == v.bc.TipHash() {
+		if err := v.validateNonces(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateNonces checks that the transactions of every sender in b carry
+// consecutive nonces, starting at the sender's next nonce.
+func (v *BlockValidator) validateNonces(b *Block) error {
+	next := make(map[types.Address]uint64)
+
+	for _, tx := range b.Transactions {
+		sender := tx.Sender()
+
+		expected, ok := next[sender]
+		if !ok {
+			expected = v.bc.NextNonce(sender)
+		}
+
+		if err := CheckNonce(sender, expected, tx.Nonce); err != nil {
+			return err
+		}
+		next[sender] = expected + 1
+	}
+
+	return nil
+}
+
+func (v *BlockValidator) ValidateState(b *Block, state *State) error {
+	root := state.Root()
+	if root != b.StateRoot {
+		return fmt.Errorf("%w: block [%s] state root [%s] - computed [%s]", ErrStateRootMismatch, b.Hash(BlockHasher{}), b.StateRoot, root)
+	}
+
+	return nil
+}
+
+// CheckNonce returns ErrNonceTooLow or ErrNonceTooHigh when nonce is not the
+// nonce expected from sender.
+func CheckNonce(sender types.Address, expected, nonce uint64) error {
+	switch {
+	case nonce < expected:
+		return fmt.Errorf("%w: [%s] sent nonce [%d] - expected [%d]", ErrNonceTooLow, sender, nonce, expected)
+	case nonce > expected:
+		return fmt.Errorf("%w: [%s] sent nonce [%d] - expected [%d]", ErrNonceTooHigh, sender, nonce, expected)
+	}
+
 	return nil
 }
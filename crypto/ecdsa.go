@@ -0,0 +1,42 @@
+package crypto
+
+import (
+	"encoding/asn1"
+	"math/big"
+)
+
+// ecdsaSignature is the ASN.1 form of an ECDSA signature, as returned by
+// crypto/ecdsa.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// parseECDSA decodes an ASN.1 ECDSA signature and moves s to the lower half
+// of the curve order n. Both r and s are public, so the math/big arithmetic
+// here leaks nothing about the key.
+func parseECDSA(der []byte, n *big.Int) (r, s *big.Int, err error) {
+	var sig ecdsaSignature
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, nil, err
+	}
+
+	if sig.S.Cmp(halfOrder(n)) > 0 {
+		sig.S.Sub(n, sig.S)
+	}
+
+	return sig.R, sig.S, nil
+}
+
+func halfOrder(n *big.Int) *big.Int {
+	return new(big.Int).Rsh(n, 1)
+}
+
+// bits2int converts b to an integer of at most the bit length of q.
+func bits2int(b []byte, q *big.Int) *big.Int {
+	v := new(big.Int).SetBytes(b)
+	if excess := len(b)*8 - q.BitLen(); excess > 0 {
+		v.Rsh(v, uint(excess))
+	}
+
+	return v
+}
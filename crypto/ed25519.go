@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// Ed25519PrivateKey is an Ed25519 key. It signs the data itself, Ed25519
+// hashes the message as part of the scheme.
+type Ed25519PrivateKey struct {
+	key ed25519.PrivateKey
+}
+
+func GenerateEd25519PrivateKey() Ed25519PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	return Ed25519PrivateKey{key: key}
+}
+
+// Ed25519PrivateKeyFromSeed derives the key from a 32 byte seed.
+func Ed25519PrivateKeyFromSeed(seed []byte) (Ed25519PrivateKey, error) {
+	if len(seed) != ed25519.SeedSize {
+		return Ed25519PrivateKey{}, fmt.Errorf("%w: expected a %d byte seed got %d", ErrInvalidPrivateKey, ed25519.SeedSize, len(seed))
+	}
+
+	return Ed25519PrivateKey{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+func (k Ed25519PrivateKey) PublicKey() PublicKey {
+	return newPublicKey(SchemeEd25519, k.key.Public().(ed25519.PublicKey))
+}
+
+func (k Ed25519PrivateKey) Sign(data []byte) (*Signature, error) {
+	sig := ed25519.Sign(k.key, data)
+
+	return &Signature{
+		Scheme: SchemeEd25519,
+		R:      new(big.Int).SetBytes(sig[:32]),
+		S:      new(big.Int).SetBytes(sig[32:]),
+	}, nil
+}
+
+type ed25519Verifier struct{}
+
+func (ed25519Verifier) Verify(key []byte, data []byte, sig *Signature) bool {
+	if len(key) != ed25519.PublicKeySize || sig.R.BitLen() > 256 || sig.S.BitLen() > 256 {
+		return false
+	}
+
+	b := make([]byte, ed25519.SignatureSize)
+	sig.R.FillBytes(b[:32])
+	sig.S.FillBytes(b[32:])
+
+	return ed25519.Verify(key, data, b)
+}
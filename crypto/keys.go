@@ -1,43 +1,102 @@
 package crypto
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
+	"sync"
 
 	"github.com/dbkbali/bcbasic/types"
 )
 
-type PrivateKey struct {
-	key *ecdsa.PrivateKey
-}
+// Scheme identifies a signature scheme. It is the first byte of every public
+// key and is carried in every signature.
+type Scheme byte
 
-func (k PrivateKey) Sign(data []byte) (*Signature, error) {
-	r, s, err := ecdsa.Sign(rand.Reader, k.key, data)
-	if err != nil {
-		return nil, err
+const (
+	SchemeP256      Scheme = 0x01
+	SchemeEd25519   Scheme = 0x02
+	SchemeSecp256k1 Scheme = 0x03
+)
+
+func (s Scheme) String() string {
+	switch s {
+	case SchemeP256:
+		return "p256"
+	case SchemeEd25519:
+		return "ed25519"
+	case SchemeSecp256k1:
+		return "secp256k1"
+	default:
+		return fmt.Sprintf("scheme(%d)", byte(s))
 	}
-	return &Signature{R: r, S: s}, nil
 }
 
-func GeneratePrivateKey() PrivateKey {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
+// Signer is a private key of any scheme.
+type Signer interface {
+	PublicKey() PublicKey
+	Sign(data []byte) (*Signature, error)
+}
+
+// Verifier checks signatures of one scheme. key is the public key without
+// its scheme byte.
+type Verifier interface {
+	Verify(key []byte, data []byte, sig *Signature) bool
+}
+
+var (
+	verifiersLock sync.RWMutex
+	verifiers     = map[Scheme]Verifier{
+		SchemeP256:    p256Verifier{},
+		SchemeEd25519: ed25519Verifier{},
+	}
+)
 
-		panic(err)
+var ErrSchemeRegistered = errors.New("scheme already registered")
+
+// RegisterVerifier makes signatures of a new scheme verifiable with v. The
+// verifier of a scheme can not be replaced, so the built in schemes always
+// verify with their own implementation.
+func RegisterVerifier(scheme Scheme, v Verifier) error {
+	verifiersLock.Lock()
+	defer verifiersLock.Unlock()
+
+	if _, ok := verifiers[scheme]; ok {
+		return fmt.Errorf("%w: %s", ErrSchemeRegistered, scheme)
 	}
 
-	return PrivateKey{key: key}
+	verifiers[scheme] = v
+	return nil
 }
 
-func (k PrivateKey) PublicKey() PublicKey {
-	return elliptic.MarshalCompressed(k.key.PublicKey.Curve, k.key.PublicKey.X, k.key.PublicKey.Y)
+func verifierFor(scheme Scheme) (Verifier, bool) {
+	verifiersLock.RLock()
+	defer verifiersLock.RUnlock()
+
+	v, ok := verifiers[scheme]
+	return v, ok
 }
 
+// PublicKey is the scheme byte followed by the key in the encoding of the
+// scheme.
 type PublicKey []byte
 
+func newPublicKey(scheme Scheme, key []byte) PublicKey {
+	return append(PublicKey{byte(scheme)}, key...)
+}
+
+// Scheme returns the scheme of the key, zero for an empty key.
+func (k PublicKey) Scheme() Scheme {
+	if len(k) == 0 {
+		return 0
+	}
+
+	return Scheme(k[0])
+}
+
 func (k PublicKey) Address() types.Address {
 	h := sha256.Sum256(k)
 
@@ -45,16 +104,76 @@ func (k PublicKey) Address() types.Address {
 
 }
 
+func (k PublicKey) String() string {
+	return hex.EncodeToString(k)
+}
+
+func (k PublicKey) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *PublicKey) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+
+	*k = b
+	return nil
+}
+
+// Signature holds the two halves of a signature. For ECDSA they are r and s,
+// for Ed25519 the first and the last 32 bytes of the signature.
 type Signature struct {
-	S, R *big.Int
+	Scheme Scheme
+	S, R   *big.Int
+}
+
+// signatureJSON is the JSON form of a signature, with R and S in hex.
+type signatureJSON struct {
+	Scheme Scheme
+	R      string
+	S      string
+}
+
+func (sig Signature) MarshalJSON() ([]byte, error) {
+	return json.Marshal(signatureJSON{
+		Scheme: sig.Scheme,
+		R:      sig.R.Text(16),
+		S:      sig.S.Text(16),
+	})
 }
 
+func (sig *Signature) UnmarshalJSON(data []byte) error {
+	var v signatureJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	r, ok := new(big.Int).SetString(v.R, 16)
+	if !ok {
+		return fmt.Errorf("invalid signature R %q", v.R)
+	}
+	s, ok := new(big.Int).SetString(v.S, 16)
+	if !ok {
+		return fmt.Errorf("invalid signature S %q", v.S)
+	}
+
+	sig.Scheme, sig.R, sig.S = v.Scheme, r, s
+	return nil
+}
+
+// Verify reports whether sig is a signature of data by pubkey. The signature
+// must be of the scheme of the key.
 func (sig Signature) Verify(pubkey PublicKey, data []byte) bool {
-	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), pubkey)
-	key := &ecdsa.PublicKey{
-		Curve: elliptic.P256(),
-		X:     x,
-		Y:     y,
+	if sig.R == nil || sig.S == nil || sig.Scheme != pubkey.Scheme() {
+		return false
 	}
-	return ecdsa.Verify(key, data, sig.R, sig.S)
+
+	v, ok := verifierFor(sig.Scheme)
+	if !ok {
+		return false
+	}
+
+	return v.Verify(pubkey[1:], data, &sig)
 }
@@ -1,6 +1,9 @@
 package crypto
 
 import (
+	"crypto/elliptic"
+	"encoding/json"
+	"math/big"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -31,3 +34,86 @@ func TestKeyPairSignVerifyFail(t *testing.T) {
 	assert.False(t, sig.Verify(otherPubKey, msg))
 	assert.False(t, sig.Verify(pubKey, []byte("Hello World!")))
 }
+
+func TestSignatureJSON(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	sig, err := privKey.Sign([]byte("Hello World"))
+	assert.Nil(t, err)
+
+	b, err := json.Marshal(sig)
+	assert.Nil(t, err)
+
+	decoded := new(Signature)
+	assert.Nil(t, json.Unmarshal(b, decoded))
+	assert.Equal(t, sig, decoded)
+	assert.True(t, decoded.Verify(privKey.PublicKey(), []byte("Hello World")))
+}
+
+func TestSignDeterministic(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	msg := []byte("Hello World")
+
+	a, err := privKey.Sign(msg)
+	assert.Nil(t, err)
+	b, err := privKey.Sign(msg)
+	assert.Nil(t, err)
+
+	assert.Equal(t, a, b)
+}
+
+// Test vectors from RFC 6979 appendix A.2.5, with S normalised to the lower
+// half of the curve order.
+func TestSignRFC6979Vectors(t *testing.T) {
+	privKey := privateKeyFromHex(t, "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")
+
+	tests := []struct {
+		msg  string
+		r, s string
+	}{
+		{
+			msg: "sample",
+			r:   "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716",
+			s:   "f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8",
+		},
+		{
+			msg: "test",
+			r:   "f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367",
+			s:   "019f4113742a2b14bd25926b49c649155f267e60d3814b4c0cc84250e46f0083",
+		},
+	}
+
+	for _, tt := range tests {
+		sig, err := privKey.Sign([]byte(tt.msg))
+		assert.Nil(t, err)
+
+		r, _ := new(big.Int).SetString(tt.r, 16)
+		s, _ := new(big.Int).SetString(tt.s, 16)
+		if s.Cmp(halfOrder(elliptic.P256().Params().N)) > 0 {
+			s.Sub(elliptic.P256().Params().N, s)
+		}
+
+		assert.Equal(t, r, sig.R, tt.msg)
+		assert.Equal(t, s, sig.S, tt.msg)
+		assert.True(t, sig.Verify(privKey.PublicKey(), []byte(tt.msg)))
+	}
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	msg := []byte("Hello World")
+
+	sig, err := privKey.Sign(msg)
+	assert.Nil(t, err)
+	assert.True(t, sig.S.Cmp(halfOrder(elliptic.P256().Params().N)) <= 0)
+
+	// (r, n-s) is valid ECDSA too, but not in our canonical form
+	high := &Signature{R: sig.R, S: new(big.Int).Sub(elliptic.P256().Params().N, sig.S)}
+	assert.False(t, high.Verify(privKey.PublicKey(), msg))
+}
+
+func privateKeyFromHex(t *testing.T, s string) PrivateKey {
+	key, err := PrivateKeyFromHex(s)
+	assert.Nil(t, err)
+
+	return key
+}
@@ -0,0 +1,189 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	keystoreCipher  = "aes-256-gcm"
+	keystoreKDF     = "scrypt"
+
+	scryptN     = 1 << 15
+	scryptR     = 8
+	scryptP     = 1
+	scryptDKLen = 32
+	// upper bounds of the scrypt cost accepted from a file, so a crafted
+	// file can not make decryption use gigabytes of memory or run for hours
+	maxScryptN = 1 << 20
+	maxScryptR = 8
+	maxScryptP = 16
+)
+
+var (
+	ErrInvalidPassword = errors.New("invalid keystore password")
+	ErrKeystoreAddress = errors.New("keystore address does not match key")
+)
+
+// keystoreFile is the JSON layout of an encrypted private key. The key is
+// sealed with AES-256-GCM under a key derived from the password by scrypt.
+// The address is in hex, so the file does not depend on the network.
+type keystoreFile struct {
+	Version int            `json:"version"`
+	Address string         `json:"address"`
+	Crypto  keystoreCrypto `json:"crypto"`
+}
+
+type keystoreCrypto struct {
+	Cipher     string       `json:"cipher"`
+	Ciphertext string       `json:"ciphertext"`
+	Nonce      string       `json:"nonce"`
+	KDF        string       `json:"kdf"`
+	KDFParams  scryptParams `json:"kdfparams"`
+}
+
+type scryptParams struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// EncryptKey returns the keystore JSON of k encrypted with password.
+func EncryptKey(k PrivateKey, password string) ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	params := scryptParams{
+		N:     scryptN,
+		R:     scryptR,
+		P:     scryptP,
+		DKLen: scryptDKLen,
+		Salt:  hex.EncodeToString(salt),
+	}
+
+	aead, err := keystoreAEAD(password, params)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(keystoreFile{
+		Version: keystoreVersion,
+		Address: k.PublicKey().Address().Hex(),
+		Crypto: keystoreCrypto{
+			Cipher:     keystoreCipher,
+			Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, k.Bytes(), nil)),
+			Nonce:      hex.EncodeToString(nonce),
+			KDF:        keystoreKDF,
+			KDFParams:  params,
+		},
+	}, "", "  ")
+}
+
+// DecryptKey is the inverse of EncryptKey.
+func DecryptKey(data []byte, password string) (PrivateKey, error) {
+	var ks keystoreFile
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return PrivateKey{}, fmt.Errorf("invalid keystore: %w", err)
+	}
+
+	if ks.Version != keystoreVersion {
+		return PrivateKey{}, fmt.Errorf("unsupported keystore version %d", ks.Version)
+	}
+	if ks.Crypto.Cipher != keystoreCipher || ks.Crypto.KDF != keystoreKDF {
+		return PrivateKey{}, fmt.Errorf("unsupported keystore cipher %s with kdf %s", ks.Crypto.Cipher, ks.Crypto.KDF)
+	}
+
+	aead, err := keystoreAEAD(password, ks.Crypto.KDFParams)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	nonce, err := hex.DecodeString(ks.Crypto.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return PrivateKey{}, fmt.Errorf("invalid keystore nonce")
+	}
+	ciphertext, err := hex.DecodeString(ks.Crypto.Ciphertext)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("invalid keystore ciphertext")
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return PrivateKey{}, ErrInvalidPassword
+	}
+
+	key, err := PrivateKeyFromBytes(plaintext)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	if key.PublicKey().Address().Hex() != ks.Address {
+		return PrivateKey{}, fmt.Errorf("%w: %s", ErrKeystoreAddress, ks.Address)
+	}
+
+	return key, nil
+}
+
+// SaveKeystore writes k encrypted with password to path, readable by the
+// owner only.
+func SaveKeystore(path string, k PrivateKey, password string) error {
+	data, err := EncryptKey(k, password)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// LoadKeystore reads and decrypts the key stored at path.
+func LoadKeystore(path string, password string) (PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	return DecryptKey(data, password)
+}
+
+func keystoreAEAD(password string, params scryptParams) (cipher.AEAD, error) {
+	if params.N <= 1 || params.N > maxScryptN ||
+		params.R < 1 || params.R > maxScryptR ||
+		params.P < 1 || params.P > maxScryptP ||
+		params.DKLen != scryptDKLen {
+		return nil, fmt.Errorf("unsupported scrypt parameters n=%d r=%d p=%d dklen=%d", params.N, params.R, params.P, params.DKLen)
+	}
+
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore salt")
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
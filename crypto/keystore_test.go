@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrivateKeyHex(t *testing.T) {
+	privKey := GeneratePrivateKey()
+
+	imported, err := PrivateKeyFromHex(privKey.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.Bytes(), imported.Bytes())
+	assert.Equal(t, privKey.PublicKey(), imported.PublicKey())
+
+	_, err = PrivateKeyFromHex("00")
+	assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+	_, err = PrivateKeyFromHex(string(make([]byte, 64)))
+	assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+}
+
+func TestPrivateKeyPEM(t *testing.T) {
+	privKey := GeneratePrivateKey()
+
+	data, err := privKey.MarshalPEM()
+	assert.Nil(t, err)
+
+	imported, err := PrivateKeyFromPEM(data)
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.Bytes(), imported.Bytes())
+
+	_, err = PrivateKeyFromPEM([]byte("foo"))
+	assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+}
+
+func TestKeystore(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	path := filepath.Join(t.TempDir(), "key.json")
+
+	assert.Nil(t, SaveKeystore(path, privKey, "secret"))
+
+	loaded, err := LoadKeystore(path, "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.Bytes(), loaded.Bytes())
+
+	msg := []byte("Hello World")
+	sig, err := loaded.Sign(msg)
+	assert.Nil(t, err)
+	assert.True(t, sig.Verify(privKey.PublicKey(), msg))
+
+	_, err = LoadKeystore(path, "wrong")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+}
+
+func TestKeystoreRejectsTampering(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	data, err := EncryptKey(privKey, "secret")
+	assert.Nil(t, err)
+
+	edit := func(f func(ks *keystoreFile)) []byte {
+		var ks keystoreFile
+		assert.Nil(t, json.Unmarshal(data, &ks))
+		f(&ks)
+		b, err := json.Marshal(ks)
+		assert.Nil(t, err)
+		return b
+	}
+
+	_, err = DecryptKey(edit(func(ks *keystoreFile) {
+		ks.Address = GeneratePrivateKey().PublicKey().Address().Hex()
+	}), "secret")
+	assert.ErrorIs(t, err, ErrKeystoreAddress)
+
+	for _, params := range []scryptParams{
+		{N: maxScryptN * 2, R: scryptR, P: scryptP},
+		{N: scryptN, R: maxScryptR + 1, P: scryptP},
+		{N: scryptN, R: scryptR, P: maxScryptP + 1},
+		{N: scryptN, R: 0, P: scryptP},
+	} {
+		_, err = DecryptKey(edit(func(ks *keystoreFile) {
+			params.DKLen, params.Salt = scryptDKLen, ks.Crypto.KDFParams.Salt
+			ks.Crypto.KDFParams = params
+		}), "secret")
+		assert.ErrorContains(t, err, "unsupported scrypt parameters")
+	}
+}
@@ -0,0 +1,148 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	privateKeySize = 32
+	pemBlockType   = "EC PRIVATE KEY"
+)
+
+var ErrInvalidPrivateKey = errors.New("invalid private key")
+
+// PrivateKey is a P-256 ECDSA key.
+type PrivateKey struct {
+	key *ecdsa.PrivateKey
+}
+
+// Sign signs the SHA-256 digest of data with deterministic ECDSA. The nonce
+// is derived from the key and the digest as in RFC 6979, so signing the same
+// data twice gives the same signature, and s is always in the lower half of
+// the curve order. Signing is done by crypto/ecdsa, which is constant time.
+func (k PrivateKey) Sign(data []byte) (*Signature, error) {
+	digest := sha256.Sum256(data)
+
+	// a nil random source makes crypto/ecdsa sign deterministically
+	der, err := k.key.Sign(nil, digest[:], stdcrypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	r, s, err := parseECDSA(der, k.key.Curve.Params().N)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signature{Scheme: SchemeP256, R: r, S: s}, nil
+}
+
+func GeneratePrivateKey() PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+
+		panic(err)
+	}
+
+	return PrivateKey{key: key}
+}
+
+// Bytes returns the private scalar as 32 big endian bytes.
+func (k PrivateKey) Bytes() []byte {
+	return k.key.D.FillBytes(make([]byte, privateKeySize))
+}
+
+// Hex returns the private scalar hex encoded.
+func (k PrivateKey) Hex() string {
+	return hex.EncodeToString(k.Bytes())
+}
+
+// MarshalPEM returns the key as a PEM encoded SEC 1 EC PRIVATE KEY block.
+func (k PrivateKey) MarshalPEM() ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemBlockType, Bytes: der}), nil
+}
+
+// PrivateKeyFromBytes is the inverse of PrivateKey.Bytes.
+func PrivateKeyFromBytes(b []byte) (PrivateKey, error) {
+	if len(b) != privateKeySize {
+		return PrivateKey{}, fmt.Errorf("%w: expected %d bytes got %d", ErrInvalidPrivateKey, privateKeySize, len(b))
+	}
+
+	key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), b)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("%w: %s", ErrInvalidPrivateKey, err)
+	}
+
+	return PrivateKey{key: key}, nil
+}
+
+// PrivateKeyFromHex is the inverse of PrivateKey.Hex.
+func PrivateKeyFromHex(s string) (PrivateKey, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("%w: %s", ErrInvalidPrivateKey, err)
+	}
+
+	return PrivateKeyFromBytes(b)
+}
+
+// PrivateKeyFromPEM is the inverse of PrivateKey.MarshalPEM.
+func PrivateKeyFromPEM(data []byte) (PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemBlockType {
+		return PrivateKey{}, fmt.Errorf("%w: no %s block", ErrInvalidPrivateKey, pemBlockType)
+	}
+
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("%w: %s", ErrInvalidPrivateKey, err)
+	}
+	if key.Curve != elliptic.P256() {
+		return PrivateKey{}, fmt.Errorf("%w: unsupported curve %s", ErrInvalidPrivateKey, key.Curve.Params().Name)
+	}
+
+	return PrivateKey{key: key}, nil
+}
+
+func (k PrivateKey) PublicKey() PublicKey {
+	return newPublicKey(SchemeP256, elliptic.MarshalCompressed(k.key.PublicKey.Curve, k.key.PublicKey.X, k.key.PublicKey.Y))
+}
+
+// p256Verifier verifies ECDSA signatures over P-256 with compressed keys.
+type p256Verifier struct{}
+
+func (p256Verifier) Verify(key []byte, data []byte, sig *Signature) bool {
+	curve := elliptic.P256()
+	if sig.S.Cmp(halfOrder(curve.Params().N)) > 0 {
+		return false
+	}
+
+	x, y := elliptic.UnmarshalCompressed(curve, key)
+	if x == nil {
+		return false
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     x,
+		Y:     y,
+	}
+	digest := sha256.Sum256(data)
+
+	return ecdsa.Verify(pub, digest[:], sig.R, sig.S)
+}
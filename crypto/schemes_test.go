@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemesSignVerify(t *testing.T) {
+	signers := []Signer{
+		GeneratePrivateKey(),
+		GenerateEd25519PrivateKey(),
+	}
+	schemes := []Scheme{SchemeP256, SchemeEd25519}
+	msg := []byte("Hello World")
+
+	for i, signer := range signers {
+		pubKey := signer.PublicKey()
+		assert.Equal(t, schemes[i], pubKey.Scheme())
+
+		sig, err := signer.Sign(msg)
+		assert.Nil(t, err)
+		assert.Equal(t, schemes[i], sig.Scheme)
+		assert.True(t, sig.Verify(pubKey, msg), schemes[i].String())
+		assert.False(t, sig.Verify(pubKey, []byte("Hello World!")), schemes[i].String())
+
+		// a signature never verifies against a key of another scheme
+		other := signers[(i+1)%len(signers)].PublicKey()
+		assert.False(t, sig.Verify(other, msg), schemes[i].String())
+	}
+}
+
+func TestEd25519FromSeed(t *testing.T) {
+	seed := make([]byte, 32)
+	a, err := Ed25519PrivateKeyFromSeed(seed)
+	assert.Nil(t, err)
+	b, err := Ed25519PrivateKeyFromSeed(seed)
+	assert.Nil(t, err)
+	assert.Equal(t, a.PublicKey(), b.PublicKey())
+
+	_, err = Ed25519PrivateKeyFromSeed(seed[:31])
+	assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+}
+
+// secp256k1 is verify only. The key 1 has the generator as public key, the
+// signature is the RFC 6979 secp256k1 test vector commonly used by bitcoin
+// libraries.
+func TestSecp256k1Vectors(t *testing.T) {
+	g, err := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	assert.Nil(t, err)
+	pubKey := newPublicKey(SchemeSecp256k1, g)
+
+	sig := Signature{
+		Scheme: SchemeSecp256k1,
+		R:      hexInt("934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8"),
+		S:      hexInt("2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"),
+	}
+	// the scheme is opt-in
+	assert.False(t, sig.Verify(pubKey, []byte("Satoshi Nakamoto")))
+	assert.Nil(t, RegisterSecp256k1())
+	t.Cleanup(func() {
+		verifiersLock.Lock()
+		delete(verifiers, SchemeSecp256k1)
+		verifiersLock.Unlock()
+	})
+	assert.ErrorIs(t, RegisterSecp256k1(), ErrSchemeRegistered)
+
+	assert.True(t, sig.Verify(pubKey, []byte("Satoshi Nakamoto")))
+	assert.False(t, sig.Verify(pubKey, []byte("Satoshi Nakamoto!")))
+
+	// the high S twin of a valid signature is rejected
+	sig.S = new(big.Int).Sub(secp256k1.n, sig.S)
+	assert.False(t, sig.Verify(pubKey, []byte("Satoshi Nakamoto")))
+}
+
+type acceptAllVerifier struct{}
+
+func (acceptAllVerifier) Verify(key []byte, data []byte, sig *Signature) bool { return true }
+
+func TestRegisterVerifier(t *testing.T) {
+	for _, scheme := range []Scheme{SchemeP256, SchemeEd25519} {
+		assert.ErrorIs(t, RegisterVerifier(scheme, acceptAllVerifier{}), ErrSchemeRegistered)
+	}
+
+	privKey := GeneratePrivateKey()
+	sig, err := privKey.Sign([]byte("foo"))
+	assert.Nil(t, err)
+	assert.False(t, sig.Verify(privKey.PublicKey(), []byte("bar")))
+}
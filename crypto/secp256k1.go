@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"math/big"
+)
+
+// secp256k1 is implemented here with math/big in affine coordinates. It is
+// neither fast nor constant time, so the scheme is verify only: signatures
+// made elsewhere are checked, but there are no secp256k1 private keys.
+var secp256k1 = struct {
+	p, n, b *big.Int
+	g       secpPoint
+}{
+	p: hexInt("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"),
+	n: hexInt("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+	b: big.NewInt(7),
+	g: secpPoint{
+		x: hexInt("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+		y: hexInt("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+	},
+}
+
+// secpPoint is a point on secp256k1, the point at infinity has a nil x.
+type secpPoint struct {
+	x, y *big.Int
+}
+
+func (p secpPoint) isInfinity() bool {
+	return p.x == nil
+}
+
+func secpAdd(a, b secpPoint) secpPoint {
+	if a.isInfinity() {
+		return b
+	}
+	if b.isInfinity() {
+		return a
+	}
+
+	prime := secp256k1.p
+	if a.x.Cmp(b.x) == 0 {
+		if a.y.Cmp(b.y) != 0 || a.y.Sign() == 0 {
+			return secpPoint{}
+		}
+		return secpDouble(a)
+	}
+
+	// lambda = (y2 - y1) / (x2 - x1)
+	num := new(big.Int).Sub(b.y, a.y)
+	den := new(big.Int).Sub(b.x, a.x)
+	den.Mod(den, prime)
+	lambda := num.Mul(num, den.ModInverse(den, prime))
+	lambda.Mod(lambda, prime)
+
+	return secpFromLambda(lambda, a, b.x)
+}
+
+func secpDouble(a secpPoint) secpPoint {
+	if a.isInfinity() || a.y.Sign() == 0 {
+		return secpPoint{}
+	}
+
+	prime := secp256k1.p
+
+	// lambda = 3x^2 / 2y
+	num := new(big.Int).Mul(a.x, a.x)
+	num.Mul(num, big.NewInt(3))
+	den := new(big.Int).Lsh(a.y, 1)
+	den.Mod(den, prime)
+	lambda := num.Mul(num, den.ModInverse(den, prime))
+	lambda.Mod(lambda, prime)
+
+	return secpFromLambda(lambda, a, a.x)
+}
+
+// secpFromLambda returns the sum of a and the point with x coordinate x2 on
+// the line through a with slope lambda.
+func secpFromLambda(lambda *big.Int, a secpPoint, x2 *big.Int) secpPoint {
+	prime := secp256k1.p
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, a.x)
+	x.Sub(x, x2)
+	x.Mod(x, prime)
+
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, lambda)
+	y.Sub(y, a.y)
+	y.Mod(y, prime)
+
+	return secpPoint{x: x, y: y}
+}
+
+func secpScalarMult(p secpPoint, k *big.Int) secpPoint {
+	result := secpPoint{}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = secpDouble(result)
+		if k.Bit(i) == 1 {
+			result = secpAdd(result, p)
+		}
+	}
+
+	return result
+}
+
+func secpDecompress(b []byte) (secpPoint, bool) {
+	if len(b) != 33 || (b[0] != 0x02 && b[0] != 0x03) {
+		return secpPoint{}, false
+	}
+
+	prime := secp256k1.p
+	x := new(big.Int).SetBytes(b[1:])
+	if x.Cmp(prime) >= 0 {
+		return secpPoint{}, false
+	}
+
+	// y^2 = x^3 + 7, p = 3 mod 4 so the root is (y^2)^((p+1)/4)
+	y2 := new(big.Int).Exp(x, big.NewInt(3), prime)
+	y2.Add(y2, secp256k1.b)
+	y2.Mod(y2, prime)
+
+	exp := new(big.Int).Add(prime, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(y2, exp, prime)
+	if new(big.Int).Exp(y, big.NewInt(2), prime).Cmp(y2) != 0 {
+		return secpPoint{}, false
+	}
+
+	if y.Bit(0) != uint(b[0]-0x02) {
+		y.Sub(prime, y)
+	}
+
+	return secpPoint{x: x, y: y}, true
+}
+
+// RegisterSecp256k1 enables verification of secp256k1 signatures. The scheme
+// is not verifiable by default: a verification takes a few milliseconds, so a
+// node accepting it can be flooded with expensive signature checks.
+func RegisterSecp256k1() error {
+	return RegisterVerifier(SchemeSecp256k1, secp256k1Verifier{})
+}
+
+type secp256k1Verifier struct{}
+
+func (secp256k1Verifier) Verify(key []byte, data []byte, sig *Signature) bool {
+	n := secp256k1.n
+	if sig.R.Sign() <= 0 || sig.R.Cmp(n) >= 0 || sig.S.Sign() <= 0 || sig.S.Cmp(halfOrder(n)) > 0 {
+		return false
+	}
+
+	pub, ok := secpDecompress(key)
+	if !ok {
+		return false
+	}
+
+	digest := sha256.Sum256(data)
+	e := bits2int(digest[:], n)
+
+	w := new(big.Int).ModInverse(sig.S, n)
+	u1 := new(big.Int).Mul(e, w)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(sig.R, w)
+	u2.Mod(u2, n)
+
+	point := secpAdd(secpScalarMult(secp256k1.g, u1), secpScalarMult(pub, u2))
+	if point.isInfinity() {
+		return false
+	}
+
+	return new(big.Int).Mod(point.x, n).Cmp(sig.R) == 0
+}
+
+func hexInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid hex integer " + s)
+	}
+
+	return v
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/dbkbali/bcbasic/core"
@@ -20,21 +23,35 @@ import (
 // 	// network.NewLocalTransport("late"),
 // }
 
+// keystoreFile is the name of the validator keystore inside the data
+// directory of the validator node.
+const keystoreFile = "validator.json"
+
 func main() {
-	privKey := crypto.GeneratePrivateKey()
-	localNode := makeServer("LOCAL_NODE", &privKey, ":3000", []string{":4000"})
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+
+	localOptions := nodeOptions(dataDir, "LOCAL_NODE", ":3000", []string{":4000"})
+	localOptions.KeystoreFile = filepath.Join(localOptions.DataDir, keystoreFile)
+	localOptions.KeystorePassword = os.Getenv("VALIDATOR_PASSWORD")
+	if err := createKeystore(localOptions.KeystoreFile, localOptions.KeystorePassword); err != nil {
+		log.Fatal(err)
+	}
+	localNode := makeServer(localOptions)
 
 	go localNode.Start()
 
-	remoteNode := makeServer("REMOTE_A", nil, ":4000", []string{":5000"})
+	remoteNode := makeServer(nodeOptions(dataDir, "REMOTE_A", ":4000", []string{":5000"}))
 	go remoteNode.Start()
 
-	remoteNodeB := makeServer("REMOTE_B", nil, ":5000", nil)
+	remoteNodeB := makeServer(nodeOptions(dataDir, "REMOTE_B", ":5000", nil))
 	go remoteNodeB.Start()
 
 	go func() {
 		time.Sleep(11 * time.Second)
-		lateNode := makeServer("LATE_NODE", nil, ":6000", []string{":4000"})
+		lateNode := makeServer(nodeOptions(dataDir, "LATE_NODE", ":6000", []string{":4000"}))
 		go lateNode.Start()
 
 	}()
@@ -46,14 +63,37 @@ func main() {
 	select {}
 }
 
-func makeServer(id string, pk *crypto.PrivateKey, addr string, seedNodes []string) *network.Server {
-	options := network.ServerOptions{
+// createKeystore creates the keystore at path with a new key on the first
+// run, the server loads it from there. An empty password is refused, so the
+// key is never stored effectively unencrypted.
+func createKeystore(path, password string) error {
+	if password == "" {
+		return errors.New("VALIDATOR_PASSWORD is not set")
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return crypto.SaveKeystore(path, crypto.GeneratePrivateKey(), password)
+}
+
+// nodeOptions returns the options of a node that keeps its blocks and peers
+// in its own directory below dataDir.
+func nodeOptions(dataDir, id, addr string, seedNodes []string) network.ServerOptions {
+	return network.ServerOptions{
 		SeedNodes:  seedNodes,
 		ListenAddr: addr,
-		PrivateKey: pk,
 		ID:         id,
+		DataDir:    filepath.Join(dataDir, id),
 	}
+}
 
+func makeServer(options network.ServerOptions) *network.Server {
 	s, err := network.NewServer(options)
 	if err != nil {
 		log.Fatal(err)
@@ -119,7 +159,7 @@ func sendTransaction(tr network.Transport, to net.Addr) error {
 	tx := core.NewTransaction(data)
 	tx.Sign(privKey)
 	buf := &bytes.Buffer{}
-	if err := tx.Encode(core.NewGobTxEncoder(buf)); err != nil {
+	if err := tx.Encode(core.NewBinaryTxEncoder(buf)); err != nil {
 		return err
 	}
 
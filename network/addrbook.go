@@ -0,0 +1,220 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAddrBookSize bounds the addresses kept, the ones seen least recently
+	// are dropped first
+	maxAddrBookSize = 1000
+	// addresses are dropped after this many failed dials in a row
+	maxDialAttempts = 5
+)
+
+// KnownAddr is a peer address with the last time the peer was seen.
+type KnownAddr struct {
+	Addr     string    `json:"addr"`
+	LastSeen time.Time `json:"lastSeen"`
+	// Attempts counts the failed dials since the peer was last seen.
+	Attempts int `json:"attempts"`
+	// Gossiped is set while the address was only learned from other peers,
+	// whose last seen times can not be trusted.
+	Gossiped bool `json:"gossiped,omitempty"`
+}
+
+// AddrBook keeps the addresses of known peers. Addresses we connected to rank
+// above the ones only learned through gossip. When it has a path it is
+// persisted there as JSON after every change.
+type AddrBook struct {
+	lock  sync.RWMutex
+	path  string
+	addrs map[string]*KnownAddr
+}
+
+// NewAddrBook loads the address book stored at path. An empty path keeps the
+// book in memory only.
+func NewAddrBook(path string) (*AddrBook, error) {
+	book := &AddrBook{
+		path:  path,
+		addrs: make(map[string]*KnownAddr),
+	}
+	if path == "" {
+		return book, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return book, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []*KnownAddr
+	if err := json.Unmarshal(data, &addrs); err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		book.addrs[a.Addr] = a
+	}
+
+	return book, nil
+}
+
+// Add records addr as seen by us at lastSeen, keeping the most recent time of
+// an address already known.
+func (b *AddrBook) Add(addr string, lastSeen time.Time) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if known, ok := b.addrs[addr]; ok {
+		if known.Gossiped || lastSeen.After(known.LastSeen) {
+			known.LastSeen = lastSeen
+			known.Attempts = 0
+			known.Gossiped = false
+		}
+		return b.save()
+	}
+
+	b.insert(&KnownAddr{Addr: addr, LastSeen: lastSeen})
+
+	return b.save()
+}
+
+// AddGossiped records addresses learned from another peer and saves the book
+// once for all of them. They never replace what we saw ourselves and do not
+// reset the failed dials of an address.
+func (b *AddrBook) AddGossiped(addrs []KnownAddr) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	changed := false
+	for _, a := range addrs {
+		known, ok := b.addrs[a.Addr]
+		if !ok {
+			b.insert(&KnownAddr{Addr: a.Addr, LastSeen: a.LastSeen, Gossiped: true})
+			changed = true
+			continue
+		}
+
+		if known.Gossiped && a.LastSeen.After(known.LastSeen) {
+			known.LastSeen = a.LastSeen
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return b.save()
+}
+
+// insert adds a new address and drops the lowest ranked one when the book is
+// full, which is the new address itself if it ranks lowest.
+func (b *AddrBook) insert(a *KnownAddr) {
+	b.addrs[a.Addr] = a
+	if len(b.addrs) > maxAddrBookSize {
+		lowest := b.sorted()[len(b.addrs)-1]
+		delete(b.addrs, lowest.Addr)
+	}
+}
+
+// MarkFailed records a failed dial of addr, which is dropped after
+// maxDialAttempts failures in a row.
+func (b *AddrBook) MarkFailed(addr string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	known, ok := b.addrs[addr]
+	if !ok {
+		return nil
+	}
+
+	known.Attempts++
+	if known.Attempts >= maxDialAttempts {
+		delete(b.addrs, addr)
+	}
+
+	return b.save()
+}
+
+func (b *AddrBook) Remove(addr string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.addrs, addr)
+
+	return b.save()
+}
+
+// Addrs returns up to max addresses, the ones we saw ourselves first and then
+// the most recently seen first. max <= 0 returns all of them.
+func (b *AddrBook) Addrs(max int) []KnownAddr {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	sorted := b.sorted()
+	if max > 0 && len(sorted) > max {
+		sorted = sorted[:max]
+	}
+
+	addrs := make([]KnownAddr, len(sorted))
+	for i, a := range sorted {
+		addrs[i] = *a
+	}
+
+	return addrs
+}
+
+func (b *AddrBook) Len() int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return len(b.addrs)
+}
+
+func (b *AddrBook) sorted() []*KnownAddr {
+	addrs := make([]*KnownAddr, 0, len(b.addrs))
+	for _, a := range b.addrs {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Gossiped != addrs[j].Gossiped {
+			return !addrs[i].Gossiped
+		}
+		if !addrs[i].LastSeen.Equal(addrs[j].LastSeen) {
+			return addrs[i].LastSeen.After(addrs[j].LastSeen)
+		}
+		return addrs[i].Addr < addrs[j].Addr
+	})
+
+	return addrs
+}
+
+// save writes the book to a temporary file first, so a crash never leaves a
+// truncated book behind.
+func (b *AddrBook) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(b.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(b.path), "."+filepath.Base(b.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, b.path)
+}
@@ -0,0 +1,112 @@
+package network
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddrBookPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), addrBookFile)
+	now := time.Unix(1700000000, 0)
+
+	book, err := NewAddrBook(path)
+	assert.Nil(t, err)
+	assert.Nil(t, book.Add("127.0.0.1:3000", now.Add(-time.Hour)))
+	assert.Nil(t, book.Add("127.0.0.1:4000", now))
+	// an older sighting does not move the last seen time back
+	assert.Nil(t, book.Add("127.0.0.1:4000", now.Add(-2*time.Hour)))
+
+	loaded, err := NewAddrBook(path)
+	assert.Nil(t, err)
+
+	addrs := loaded.Addrs(0)
+	assert.Len(t, addrs, 2)
+	assert.Equal(t, "127.0.0.1:4000", addrs[0].Addr)
+	assert.True(t, now.Equal(addrs[0].LastSeen))
+	assert.Equal(t, "127.0.0.1:3000", addrs[1].Addr)
+
+	assert.Len(t, loaded.Addrs(1), 1)
+}
+
+func TestAddrBookDropsFailingAddrs(t *testing.T) {
+	book, err := NewAddrBook("")
+	assert.Nil(t, err)
+	assert.Nil(t, book.Add("127.0.0.1:3000", time.Now()))
+
+	for i := 0; i < maxDialAttempts-1; i++ {
+		assert.Nil(t, book.MarkFailed("127.0.0.1:3000"))
+	}
+	assert.Equal(t, 1, book.Len())
+
+	assert.Nil(t, book.MarkFailed("127.0.0.1:3000"))
+	assert.Equal(t, 0, book.Len())
+}
+
+func TestAddrBookBounded(t *testing.T) {
+	book, err := NewAddrBook("")
+	assert.Nil(t, err)
+
+	start := time.Unix(1700000000, 0)
+	for i := 0; i <= maxAddrBookSize; i++ {
+		addr := fmt.Sprintf("10.0.%d.%d:3000", i/256, i%256)
+		assert.Nil(t, book.Add(addr, start.Add(time.Duration(i)*time.Second)))
+	}
+
+	assert.Equal(t, maxAddrBookSize, book.Len())
+	// the address seen first was dropped
+	for _, known := range book.Addrs(0) {
+		assert.True(t, known.LastSeen.After(start))
+	}
+}
+
+func TestAddrBookGossipRanksBelowSeen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), addrBookFile)
+	now := time.Unix(1700000000, 0)
+
+	book, err := NewAddrBook(path)
+	assert.Nil(t, err)
+	assert.Nil(t, book.Add("127.0.0.1:3000", now.Add(-time.Hour)))
+	assert.Nil(t, book.MarkFailed("127.0.0.1:3000"))
+
+	assert.Nil(t, book.AddGossiped([]KnownAddr{
+		{Addr: "127.0.0.1:3000", LastSeen: now},
+		{Addr: "127.0.0.1:4000", LastSeen: now},
+	}))
+
+	loaded, err := NewAddrBook(path)
+	assert.Nil(t, err)
+
+	// gossip neither refreshes nor forgives an address we saw ourselves
+	addrs := loaded.Addrs(0)
+	assert.Len(t, addrs, 2)
+	assert.Equal(t, "127.0.0.1:3000", addrs[0].Addr)
+	assert.True(t, now.Add(-time.Hour).Equal(addrs[0].LastSeen))
+	assert.Equal(t, 1, addrs[0].Attempts)
+	assert.Equal(t, "127.0.0.1:4000", addrs[1].Addr)
+	assert.True(t, addrs[1].Gossiped)
+
+	// seeing the gossiped address ourselves promotes it
+	assert.Nil(t, loaded.Add("127.0.0.1:4000", now.Add(-2*time.Hour)))
+	addrs = loaded.Addrs(0)
+	assert.False(t, addrs[1].Gossiped)
+	assert.True(t, now.Add(-2*time.Hour).Equal(addrs[1].LastSeen))
+}
+
+func TestAddrBookGossipDoesNotEvictSeen(t *testing.T) {
+	book, err := NewAddrBook("")
+	assert.Nil(t, err)
+
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < maxAddrBookSize; i++ {
+		addr := fmt.Sprintf("10.0.%d.%d:3000", i/256, i%256)
+		assert.Nil(t, book.Add(addr, start))
+	}
+
+	assert.Nil(t, book.AddGossiped([]KnownAddr{{Addr: "10.1.0.1:3000", LastSeen: start.Add(time.Hour)}}))
+	assert.Equal(t, maxAddrBookSize, book.Len())
+	assert.False(t, hasAddr(book, "10.1.0.1:3000"))
+}
@@ -0,0 +1,214 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	addrBookFile            = "peers.json"
+	defaultMaxOutboundPeers = 8
+	defaultDialInterval     = 2 * time.Second
+	// peers are asked for the addresses they know on connect and then every
+	// peerExchangeInterval, so nodes that joined later are learned too
+	defaultPeerExchangeInterval = 30 * time.Second
+	// maxPeersPerMessage bounds the addresses of a PeersMessage
+	maxPeersPerMessage = 64
+	maxPeerAddrLen     = 256
+)
+
+// dialableAddr is the address other nodes can dial a peer on: the address it
+// advertised, with an unspecified host replaced by the host it connected
+// from.
+func dialableAddr(from net.Addr, advertised string) string {
+	tcpAddr, ok := from.(*net.TCPAddr)
+	if !ok {
+		return advertised
+	}
+
+	host, port, err := net.SplitHostPort(advertised)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = tcpAddr.IP.String()
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+func (s *Server) sendGetPeersMessage(to net.Addr) error {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(new(GetPeersMessage)); err != nil {
+		return err
+	}
+
+	msg := NewMessage(MessageTypeGetPeers, buf.Bytes())
+	return s.Transport.SendMessage(to, msg.Bytes())
+}
+
+func (s *Server) peerExchangeLoop() {
+	ticker := time.NewTicker(s.peerExchangeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.quitCh:
+			return
+		}
+
+		s.mu.RLock()
+		peers := make([]net.Addr, 0, len(s.peers))
+		for _, p := range s.peers {
+			if p.handshake != nil {
+				peers = append(peers, p.addr)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, addr := range peers {
+			if err := s.sendGetPeersMessage(addr); err != nil {
+				s.Logger.Log("err", err)
+			}
+		}
+	}
+}
+
+// processGetPeersMessage answers with the most recently seen addresses of the
+// address book.
+func (s *Server) processGetPeersMessage(from net.Addr, data *GetPeersMessage) error {
+	peersMsg := new(PeersMessage)
+	for _, known := range s.addrBook.Addrs(maxPeersPerMessage) {
+		peersMsg.Peers = append(peersMsg.Peers, PeerAddress{
+			Addr:     known.Addr,
+			LastSeen: known.LastSeen.Unix(),
+		})
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(peersMsg); err != nil {
+		return err
+	}
+
+	msg := NewMessage(MessageTypePeers, buf.Bytes())
+	return s.Transport.SendMessage(from, msg.Bytes())
+}
+
+// processPeersMessage adds the valid addresses to the address book as
+// gossiped. Last seen times in the future are capped to now.
+func (s *Server) processPeersMessage(from net.Addr, data *PeersMessage) error {
+	if len(data.Peers) > maxPeersPerMessage {
+		return fmt.Errorf("peer [%s] sent %d addresses, max %d", from, len(data.Peers), maxPeersPerMessage)
+	}
+
+	now := time.Now()
+	own := s.Transport.Addr().String()
+	addrs := make([]KnownAddr, 0, len(data.Peers))
+	for _, peer := range data.Peers {
+		if !validPeerAddr(peer.Addr) || peer.Addr == own || s.isOwnAddr(peer.Addr) {
+			continue
+		}
+
+		lastSeen := time.Unix(peer.LastSeen, 0)
+		if lastSeen.After(now) {
+			lastSeen = now
+		}
+
+		addrs = append(addrs, KnownAddr{Addr: peer.Addr, LastSeen: lastSeen})
+	}
+
+	return s.addrBook.AddGossiped(addrs)
+}
+
+// validPeerAddr reports whether addr is a host:port a peer can be dialed on.
+func validPeerAddr(addr string) bool {
+	if len(addr) > maxPeerAddrLen {
+		return false
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+
+	n, err := strconv.ParseUint(port, 10, 16)
+	return err == nil && n != 0
+}
+
+func (s *Server) isOwnAddr(addr string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ownAddrs[addr]
+}
+
+// dialLoop keeps MaxOutboundPeers outgoing connections, dialing addresses of
+// the address book.
+func (s *Server) dialLoop(dialer Dialer) {
+	ticker := time.NewTicker(s.dialInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, addr := range s.dialCandidates() {
+			go s.dialPeer(dialer, addr)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.quitCh:
+			return
+		}
+	}
+}
+
+// dialCandidates picks the most recently seen addresses we are not connected
+// to, as many as outgoing connections are missing.
+func (s *Server) dialCandidates() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outbound := len(s.dialing)
+	connected := make(map[string]bool, len(s.peers))
+	for _, p := range s.peers {
+		if p.outgoing {
+			outbound++
+		}
+		connected[p.dialed] = true
+		connected[p.listenAddr] = true
+	}
+
+	candidates := []string{}
+	for _, known := range s.addrBook.Addrs(0) {
+		if outbound+len(candidates) >= s.MaxOutboundPeers {
+			break
+		}
+		if connected[known.Addr] || s.dialing[known.Addr] {
+			continue
+		}
+
+		s.dialing[known.Addr] = true
+		candidates = append(candidates, known.Addr)
+	}
+
+	return candidates
+}
+
+func (s *Server) dialPeer(dialer Dialer, addr string) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.dialing, addr)
+		s.mu.Unlock()
+	}()
+
+	if err := dialer.Dial(addr); err != nil {
+		s.Logger.Log("msg", "failed to dial peer", "addr", addr, "err", err)
+		if err := s.addrBook.MarkFailed(addr); err != nil {
+			s.Logger.Log("err", err)
+		}
+	}
+}
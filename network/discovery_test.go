@@ -0,0 +1,116 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialableAddr(t *testing.T) {
+	from := &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 51000}
+
+	assert.Equal(t, "10.0.0.7:3000", dialableAddr(from, ":3000"))
+	assert.Equal(t, "10.0.0.7:3000", dialableAddr(from, "[::]:3000"))
+	assert.Equal(t, "10.0.0.9:3000", dialableAddr(from, "10.0.0.9:3000"))
+	assert.Equal(t, "", dialableAddr(from, "garbage"))
+	assert.Equal(t, "B", dialableAddr(NetAddress("A"), "B"))
+}
+
+func TestValidPeerAddr(t *testing.T) {
+	assert.True(t, validPeerAddr("10.0.0.7:3000"))
+	assert.True(t, validPeerAddr("[::1]:3000"))
+	assert.True(t, validPeerAddr("node.example:3000"))
+
+	assert.False(t, validPeerAddr(""))
+	assert.False(t, validPeerAddr("10.0.0.7"))
+	assert.False(t, validPeerAddr(":3000"))
+	assert.False(t, validPeerAddr("10.0.0.7:0"))
+	assert.False(t, validPeerAddr("10.0.0.7:70000"))
+	assert.False(t, validPeerAddr("10.0.0.7:http"))
+}
+
+func TestPeerExchange(t *testing.T) {
+	var (
+		trA = NewLocalTransport(NetAddress("10.0.0.1:3000"))
+		trB = NewLocalTransport(NetAddress("10.0.0.2:3000"))
+		trC = NewLocalTransport(NetAddress("10.0.0.3:3000"))
+	)
+	// B and C only know A
+	connectAll(t, trA, trB)
+	connectAll(t, trA, trC)
+
+	a := newLocalServer(t, "A", trA, nil)
+	b := newLocalServer(t, "B", trB, nil)
+	c := newLocalServer(t, "C", trC, nil)
+	for _, s := range []*Server{a, b, c} {
+		s.peerExchangeInterval = 20 * time.Millisecond
+		go s.Start()
+	}
+
+	assert.Eventually(t, func() bool {
+		return hasAddr(b.addrBook, "10.0.0.3:3000") && hasAddr(c.addrBook, "10.0.0.2:3000")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDiscoveryDialsLearnedPeers(t *testing.T) {
+	addrA, addrB, addrC := freeAddr(t), freeAddr(t), freeAddr(t)
+
+	// a chain of seeds: C only knows B, which only knows A
+	a := newTCPServer(t, addrA)
+	b := newTCPServer(t, addrB, addrA)
+	c := newTCPServer(t, addrC, addrB)
+	for _, s := range []*Server{a, b, c} {
+		go s.Start()
+	}
+
+	assert.Eventually(t, func() bool {
+		return connectedToNode(c, a.nodeID)
+	}, 10*time.Second, 20*time.Millisecond)
+}
+
+func newTCPServer(t *testing.T, addr string, seeds ...string) *Server {
+	s, err := NewServer(ServerOptions{
+		ListenAddr:     addr,
+		SeedNodes:      seeds,
+		ReconnectDelay: 10 * time.Millisecond,
+		Logger:         log.NewNopLogger(),
+	})
+	assert.Nil(t, err)
+	s.dialInterval = 20 * time.Millisecond
+
+	return s
+}
+
+func connectedToNode(s *Server, nodeID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.peers {
+		if p.handshake != nil && p.handshake.NodeID == nodeID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasAddr(book *AddrBook, addr string) bool {
+	for _, known := range book.Addrs(0) {
+		if known.Addr == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
@@ -0,0 +1,72 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Every message on a TCP connection is sent as a frame:
+//
+//	length u32 | crc32c(payload) u32 | payload
+//
+// so messages larger than a single read and messages coalesced by TCP are
+// delivered intact.
+const (
+	frameHeaderSize = 8
+	// maxFrameSize bounds the payload of a frame. It leaves room for a block
+	// of core.MaxBlockSize, replies carrying several blocks are paged below
+	// it, see maxBlocksReplySize.
+	maxFrameSize = 1 << 25
+)
+
+var (
+	ErrFrameTooLarge = errors.New("frame too large")
+	ErrFrameChecksum = errors.New("frame checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func writeFrame(w io.Writer, payload []byte) error {
+	if len(payload) > maxFrameSize {
+		return fmt.Errorf("%w: %d bytes of max %d", ErrFrameTooLarge, len(payload), maxFrameSize)
+	}
+
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, castagnoli))
+	copy(frame[frameHeaderSize:], payload)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads the next frame from r and returns its payload. io.EOF is
+// returned when r ends between frames.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("%w: %d bytes of max %d", ErrFrameTooLarge, size, maxFrameSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, ErrFrameChecksum
+	}
+
+	return payload, nil
+}
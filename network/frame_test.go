@@ -0,0 +1,83 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	large := bytes.Repeat([]byte{0xab}, 1<<20)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, writeFrame(buf, large))
+	assert.Nil(t, writeFrame(buf, []byte("foo")))
+	assert.Nil(t, writeFrame(buf, nil))
+
+	for _, want := range [][]byte{large, []byte("foo"), {}} {
+		got, err := readFrame(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := readFrame(buf)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFrameRejectsCorruption(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, writeFrame(buf, []byte("foobar")))
+
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+	_, err := readFrame(bytes.NewReader(data))
+	assert.ErrorIs(t, err, ErrFrameChecksum)
+
+	_, err = readFrame(bytes.NewReader(data[:len(data)-2]))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestFrameRejectsOversized(t *testing.T) {
+	header := make([]byte, frameHeaderSize)
+	binary.BigEndian.PutUint32(header, maxFrameSize+1)
+
+	_, err := readFrame(bytes.NewReader(header))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+
+	assert.ErrorIs(t, writeFrame(io.Discard, make([]byte, maxFrameSize+1)), ErrFrameTooLarge)
+}
+
+func TestTCPPeerDeliversWholeMessages(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	rpcCh := make(chan RPC, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		(&TCPPeer{conn: conn}).readLoop(rpcCh, make(chan struct{}))
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	peer := &TCPPeer{conn: conn, Outgoing: true}
+	large := bytes.Repeat([]byte("block"), 10000)
+	assert.Nil(t, peer.Send(large))
+	assert.Nil(t, peer.Send([]byte("small")))
+
+	for _, want := range [][]byte{large, []byte("small")} {
+		rpc := <-rpcCh
+		got, err := io.ReadAll(rpc.Payload)
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+}
@@ -0,0 +1,166 @@
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dbkbali/bcbasic/core"
+	"github.com/dbkbali/bcbasic/types"
+)
+
+// protocolVersion is the version of the messages exchanged between nodes.
+// Peers on another version are disconnected.
+const protocolVersion uint32 = 1
+
+var ErrIncompatiblePeer = errors.New("incompatible peer")
+
+// peerInfo is what the server knows about a connected peer.
+type peerInfo struct {
+	addr     net.Addr
+	outgoing bool
+	// dialed is the address an outgoing connection was dialed with
+	dialed string
+	// listenAddr is the address other nodes can dial the peer on, known once
+	// the handshake is done
+	listenAddr string
+	// handshake is nil until the handshake of the peer was accepted
+	handshake *HandshakeMessage
+	// rejected peers are incompatible and not dialed again
+	rejected bool
+	// syncing is set while blocks are requested from the peer
+	syncing bool
+}
+
+func newNodeID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// addPeer records a new connection and sends our handshake on it.
+func (s *Server) addPeer(ev PeerEvent) error {
+	s.mu.Lock()
+	p, ok := s.peers[ev.Addr.String()]
+	if !ok {
+		p = &peerInfo{addr: ev.Addr}
+		s.peers[ev.Addr.String()] = p
+	}
+	p.outgoing, p.dialed = ev.Outgoing, ev.Dialed
+	s.mu.Unlock()
+
+	return s.sendHandshake(ev.Addr)
+}
+
+// handshakeDone reports whether the peer at addr sent a compatible handshake.
+func (s *Server) handshakeDone(addr net.Addr) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.peers[addr.String()]
+	return ok && p.handshake != nil
+}
+
+func (s *Server) handshake() *HandshakeMessage {
+	return &HandshakeMessage{
+		ProtocolVersion: protocolVersion,
+		ChainID:         s.chain.ChainID(),
+		GenesisHash:     s.genesisHash,
+		NodeID:          s.nodeID,
+		Height:          s.chain.Height(),
+		ListenAddr:      s.Transport.Addr().String(),
+	}
+}
+
+func (s *Server) sendHandshake(to net.Addr) error {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(s.handshake()); err != nil {
+		return err
+	}
+
+	msg := NewMessage(MessageTypeHandshake, buf.Bytes())
+	return s.Transport.SendMessage(to, msg.Bytes())
+}
+
+// processHandshake accepts the peer if it is compatible and disconnects it
+// otherwise. Accepted peers are added to the address book and asked for the
+// peers they know, blocks are requested from peers that are ahead of us.
+func (s *Server) processHandshake(from net.Addr, data *HandshakeMessage) error {
+	s.mu.Lock()
+	p, ok := s.peers[from.String()]
+	if !ok {
+		p = &peerInfo{addr: from}
+		s.peers[from.String()] = p
+	}
+
+	if err := s.checkHandshake(data); err != nil {
+		p.rejected = true
+		dialed := p.dialed
+		if dialed != "" && data.NodeID == s.nodeID {
+			s.ownAddrs[dialed] = true
+		}
+		s.mu.Unlock()
+
+		// do not dial incompatible peers or ourselves again
+		if dialed != "" {
+			s.addrBook.Remove(dialed)
+		}
+		s.Transport.Disconnect(from)
+		return fmt.Errorf("disconnected [%s]: %w", from, err)
+	}
+
+	p.handshake = data
+	p.listenAddr = dialableAddr(from, data.ListenAddr)
+	listenAddr := p.listenAddr
+	s.mu.Unlock()
+
+	s.Logger.Log("msg", "handshake done", "addr", from, "node", data.NodeID, "height", data.Height)
+
+	if listenAddr != "" {
+		if err := s.addrBook.Add(listenAddr, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	if err := s.sendGetPeersMessage(from); err != nil {
+		return err
+	}
+
+	if data.Height > s.chain.Height() {
+		s.syncFrom(from)
+	}
+
+	return nil
+}
+
+func (s *Server) checkHandshake(data *HandshakeMessage) error {
+	switch {
+	case data.ProtocolVersion != protocolVersion:
+		return fmt.Errorf("%w: protocol version [%d] expected [%d]", ErrIncompatiblePeer, data.ProtocolVersion, protocolVersion)
+	case data.ChainID != s.chain.ChainID():
+		return fmt.Errorf("%w: %s", ErrIncompatiblePeer, core.ErrChainIDMismatch)
+	case data.GenesisHash != s.genesisHash:
+		return fmt.Errorf("%w: genesis [%s] expected [%s]", ErrIncompatiblePeer, data.GenesisHash, s.genesisHash)
+	case data.NodeID == s.nodeID:
+		return fmt.Errorf("%w: connected to ourselves", ErrIncompatiblePeer)
+	}
+
+	return nil
+}
+
+func genesisHash(chain *core.Blockchain) (types.Hash, error) {
+	header, err := chain.GetHeader(0)
+	if err != nil {
+		return types.Hash{}, err
+	}
+
+	return core.BlockHasher{}.Hash(header), nil
+}
@@ -0,0 +1,86 @@
+package network
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dbkbali/bcbasic/core"
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/dbkbali/bcbasic/types"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckHandshake(t *testing.T) {
+	s := newLocalServer(t, "A", NewLocalTransport(NetAddress("A")), nil)
+
+	remote := s.handshake()
+	remote.NodeID = newNodeID()
+	assert.Nil(t, s.checkHandshake(remote))
+
+	for _, modify := range []func(h *HandshakeMessage){
+		func(h *HandshakeMessage) { h.ProtocolVersion++ },
+		func(h *HandshakeMessage) { h.ChainID++ },
+		func(h *HandshakeMessage) { h.GenesisHash = types.Hash{0x01} },
+		func(h *HandshakeMessage) { h.NodeID = s.nodeID },
+	} {
+		h := *remote
+		modify(&h)
+		assert.ErrorIs(t, s.checkHandshake(&h), ErrIncompatiblePeer)
+	}
+}
+
+func TestForeignChainPeerDisconnected(t *testing.T) {
+	trA := NewLocalTransport(NetAddress("A"))
+	trB := NewLocalTransport(NetAddress("B"))
+	connectAll(t, trA, trB)
+
+	validator := newLocalServer(t, "A", trA, crypto.GeneratePrivateKey())
+	foreign, err := NewServer(ServerOptions{
+		ID:        "B",
+		Transport: trB,
+		ChainID:   2,
+		Logger:    log.NewNopLogger(),
+	})
+	assert.Nil(t, err)
+
+	go validator.Start()
+	go foreign.Start()
+
+	assert.Eventually(t, func() bool {
+		return !hasLocalPeer(trA, trB.Addr()) && !hasLocalPeer(trB, trA.Addr())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool { return validator.chain.Height() >= 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint32(0), foreign.chain.Height())
+}
+
+func TestMessagesBeforeHandshakeDropped(t *testing.T) {
+	trA := NewLocalTransport(NetAddress("A"))
+	// a peer that never sends a handshake
+	trX := NewLocalTransport(NetAddress("X"))
+	connectAll(t, trA, trX)
+
+	s := newLocalServer(t, "A", trA, nil)
+	go s.Start()
+
+	tx := core.NewTransaction(nil)
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	buf := &bytes.Buffer{}
+	assert.Nil(t, tx.Encode(core.NewBinaryTxEncoder(buf)))
+	assert.Nil(t, trX.SendMessage(trA.Addr(), NewMessage(MessageTypeTx, buf.Bytes()).Bytes()))
+
+	assert.Never(t, func() bool {
+		return s.memPool.Contains(tx.Hash(core.TxHasher{}))
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func hasLocalPeer(tr *LocalTransport, addr net.Addr) bool {
+	tr.lock.RLock()
+	defer tr.lock.RUnlock()
+
+	_, ok := tr.peers[addr]
+	return ok
+}
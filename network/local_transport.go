@@ -7,9 +7,13 @@ import (
 	"sync"
 )
 
+// LocalTransport connects servers of the same process, for tests and
+// simulations. Connect is one way, both transports have to connect to each
+// other to exchange messages.
 type LocalTransport struct {
 	addr       net.Addr
 	consumerCh chan RPC
+	peerCh     chan PeerEvent
 	lock       sync.RWMutex
 	peers      map[net.Addr]*LocalTransport
 }
@@ -18,33 +22,69 @@ func NewLocalTransport(addr net.Addr) *LocalTransport {
 	return &LocalTransport{
 		addr:       addr,
 		consumerCh: make(chan RPC, 1024),
+		peerCh:     make(chan PeerEvent, 1024),
 		peers:      make(map[net.Addr]*LocalTransport),
 	}
 }
 
+func (t *LocalTransport) Start() error {
+	return nil
+}
+
 func (t *LocalTransport) Consume() <-chan RPC {
 	return t.consumerCh
 }
 
+func (t *LocalTransport) Peers() <-chan PeerEvent {
+	return t.peerCh
+}
+
 func (t *LocalTransport) Connect(tr Transport) error {
-	trans := tr.(*LocalTransport)
-	t.lock.Lock()
-	defer t.lock.Unlock()
+	trans, ok := tr.(*LocalTransport)
+	if !ok {
+		return fmt.Errorf("%s: can not connect to transport %T", t.addr, tr)
+	}
 
+	t.lock.Lock()
 	t.peers[tr.Addr()] = trans
+	t.lock.Unlock()
+
+	t.peerCh <- PeerEvent{Addr: tr.Addr(), Outgoing: true}
 
 	return nil
 }
 
-func (t *LocalTransport) SendMessage(addr net.Addr, payload []byte) error {
-	t.lock.RLock()
-	defer t.lock.RUnlock()
+// Disconnect drops the link to addr in both directions, as closing a
+// connection does.
+func (t *LocalTransport) Disconnect(addr net.Addr) error {
+	t.lock.Lock()
+	peer, ok := t.peers[addr]
+	delete(t.peers, addr)
+	t.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
 
+	peer.lock.Lock()
+	delete(peer.peers, t.addr)
+	peer.lock.Unlock()
+
+	t.peerCh <- PeerEvent{Addr: addr, Outgoing: true, Disconnected: true}
+	peer.peerCh <- PeerEvent{Addr: t.addr, Disconnected: true}
+
+	return nil
+}
+
+func (t *LocalTransport) SendMessage(addr net.Addr, payload []byte) error {
 	if t.addr == addr {
 		return nil // don't send message to self
 	}
 
+	t.lock.RLock()
 	peer, ok := t.peers[addr]
+	t.lock.RUnlock()
+
 	if !ok {
 		return fmt.Errorf("%s: no peer with address %s", t.addr, addr)
 	}
@@ -59,18 +99,17 @@ func (t *LocalTransport) SendMessage(addr net.Addr, payload []byte) error {
 
 func (t *LocalTransport) Broadcast(payload []byte) error {
 	t.lock.RLock()
-	defer t.lock.RUnlock()
+	addrs := make([]net.Addr, 0, len(t.peers))
+	for addr := range t.peers {
+		addrs = append(addrs, addr)
+	}
+	t.lock.RUnlock()
 
-	for _, peer := range t.peers {
-		if err := t.SendMessage(peer.Addr(), payload); err != nil {
+	for _, addr := range addrs {
+		if err := t.SendMessage(addr, payload); err != nil {
 			return err
 		}
 	}
-	// 	peer.consumerCh <- RPC{
-	// 		From:    t.addr,
-	// 		Payload: bytes.NewReader(payload),
-	// 	}
-	// }
 
 	return nil
 }
@@ -1,6 +1,9 @@
 package network
 
-import "github.com/dbkbali/bcbasic/core"
+import (
+	"github.com/dbkbali/bcbasic/core"
+	"github.com/dbkbali/bcbasic/types"
+)
 
 type GetBlocksMessage struct {
 	From uint32
@@ -9,6 +12,7 @@ type GetBlocksMessage struct {
 	To uint32
 }
 
+// BlocksMessage is sent in the binary blocks encoding of core.
 type BlocksMessage struct {
 	Blocks []*core.Block
 }
@@ -21,3 +25,31 @@ type StatusMessage struct {
 	Version       uint32
 	CurrentHeight uint32
 }
+
+// HandshakeMessage is the first message sent on every connection. Peers that
+// speak another protocol version or follow another chain are disconnected.
+type HandshakeMessage struct {
+	ProtocolVersion uint32
+	ChainID         uint64
+	GenesisHash     types.Hash
+	// NodeID is random per process, it detects connections to ourselves
+	NodeID string
+	Height uint32
+	// ListenAddr is the address the node accepts connections on, shared
+	// with other nodes through peer exchange
+	ListenAddr string
+}
+
+type GetPeersMessage struct {
+}
+
+// PeersMessage answers GetPeersMessage with the addresses of known peers.
+type PeersMessage struct {
+	Peers []PeerAddress
+}
+
+type PeerAddress struct {
+	Addr string
+	// LastSeen is a unix timestamp in seconds
+	LastSeen int64
+}
@@ -0,0 +1,103 @@
+package network
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultReconnectDelay = time.Second
+	maxReconnectDelay     = time.Minute
+)
+
+// handlePeerEvent greets new peers and forgets disconnected ones. Seed nodes
+// are dialed again unless they were disconnected for being incompatible.
+func (s *Server) handlePeerEvent(ev PeerEvent) error {
+	if !ev.Disconnected {
+		s.Logger.Log("msg", "new peer added", "outgoing", ev.Outgoing, "addr", ev.Addr)
+		return s.addPeer(ev)
+	}
+
+	s.mu.Lock()
+	p, ok := s.peers[ev.Addr.String()]
+	delete(s.peers, ev.Addr.String())
+	s.mu.Unlock()
+
+	s.Logger.Log("msg", "peer disconnected", "addr", ev.Addr)
+
+	if ok && p.rejected {
+		return nil
+	}
+	if ok && p.listenAddr != "" {
+		if err := s.addrBook.Add(p.listenAddr, time.Now()); err != nil {
+			return err
+		}
+	}
+	if ev.Dialed != "" && s.isSeed(ev.Dialed) {
+		go s.dialSeed(ev.Dialed)
+	}
+
+	return nil
+}
+
+func (s *Server) isSeed(addr string) bool {
+	for _, seed := range s.SeedNodes {
+		if seed == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dialSeed dials addr until it succeeds or the server stops, doubling the
+// delay between attempts up to maxReconnectDelay. The delay is jittered so
+// nodes that lost the same seed do not dial it in lockstep. Only one dialSeed
+// runs per address.
+func (s *Server) dialSeed(addr string) {
+	dialer, ok := s.Transport.(Dialer)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	if s.dialing[addr] {
+		s.mu.Unlock()
+		return
+	}
+	s.dialing[addr] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.dialing, addr)
+		s.mu.Unlock()
+	}()
+
+	delay := s.ReconnectDelay
+	for {
+		err := dialer.Dial(addr)
+		if err == nil {
+			return
+		}
+
+		wait := jitter(delay)
+		s.Logger.Log("msg", "failed to dial seed node", "addr", addr, "err", err, "retry in", wait)
+
+		select {
+		case <-time.After(wait):
+		case <-s.quitCh:
+			return
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// jitter returns a random duration between d/2 and d.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d/2+1)
+}
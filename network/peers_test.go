@@ -0,0 +1,145 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPTransportReportsDisconnect(t *testing.T) {
+	a, b := NewTCPTransport("127.0.0.1:0"), NewTCPTransport("127.0.0.1:0")
+	assert.Nil(t, a.Start())
+	assert.Nil(t, b.Start())
+	assert.Nil(t, a.Connect(b))
+
+	outgoing := nextPeerEvent(t, a)
+	assert.Equal(t, b.Addr().String(), outgoing.Dialed)
+	incoming := nextPeerEvent(t, b)
+
+	assert.Nil(t, b.Disconnect(incoming.Addr))
+	assert.True(t, nextPeerEvent(t, b).Disconnected)
+
+	ev := nextPeerEvent(t, a)
+	assert.True(t, ev.Disconnected)
+	assert.True(t, ev.Outgoing)
+	assert.Equal(t, outgoing.Addr, ev.Addr)
+	assert.Equal(t, b.Addr().String(), ev.Dialed)
+
+	assert.NotNil(t, a.SendMessage(outgoing.Addr, []byte("foo")))
+}
+
+func TestServerReconnectsToSeed(t *testing.T) {
+	// reserve an address for a seed that is not up yet
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	seedAddr := ln.Addr().String()
+	ln.Close()
+
+	s, err := NewServer(ServerOptions{
+		ListenAddr:     "127.0.0.1:0",
+		SeedNodes:      []string{seedAddr},
+		ReconnectDelay: 10 * time.Millisecond,
+		Logger:         log.NewNopLogger(),
+	})
+	assert.Nil(t, err)
+	go s.Start()
+
+	time.Sleep(50 * time.Millisecond)
+	seed := NewTCPTransport(seedAddr)
+	assert.Nil(t, seed.Start())
+
+	first := nextPeerEvent(t, seed)
+	assert.False(t, first.Disconnected)
+
+	// the node dials the seed again after the connection is dropped
+	assert.Nil(t, seed.Disconnect(first.Addr))
+	assert.True(t, nextPeerEvent(t, seed).Disconnected)
+
+	second := nextPeerEvent(t, seed)
+	assert.False(t, second.Disconnected)
+	assert.NotEqual(t, first.Addr.String(), second.Addr.String())
+}
+
+func TestServerStopEndsSeedDialing(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	seedAddr := ln.Addr().String()
+	ln.Close()
+
+	s, err := NewServer(ServerOptions{
+		ListenAddr:     "127.0.0.1:0",
+		SeedNodes:      []string{seedAddr},
+		ReconnectDelay: time.Hour,
+		Logger:         log.NewNopLogger(),
+	})
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		s.Start()
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.dialing[seedAddr]
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a second dialSeed for the same seed returns at once
+	s.dialSeed(seedAddr)
+
+	s.Stop()
+	<-done
+
+	assert.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return !s.dialing[seedAddr]
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTCPTransportCloseUnblocksPeerEvents(t *testing.T) {
+	a, b := NewTCPTransport("127.0.0.1:0"), NewTCPTransport("127.0.0.1:0")
+	assert.Nil(t, a.Start())
+	assert.Nil(t, b.Start())
+
+	// nobody reads the events of a, fill its queue
+	for len(a.peerCh) < cap(a.peerCh) {
+		a.peerCh <- PeerEvent{}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.Connect(b)
+		close(done)
+	}()
+
+	assert.Nil(t, a.Close())
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connect blocked after close")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Second)
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, time.Second)
+	}
+}
+
+func nextPeerEvent(t *testing.T, tr Transport) PeerEvent {
+	select {
+	case ev := <-tr.Peers():
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no peer event")
+		return PeerEvent{}
+	}
+}
@@ -21,6 +21,9 @@ const (
 	MessageTypeStatus    MessageType = 0x4
 	MessageTypeGetStatus MessageType = 0x5
 	MessageTypeBlocks    MessageType = 0x6
+	MessageTypeHandshake MessageType = 0x7
+	MessageTypeGetPeers  MessageType = 0x8
+	MessageTypePeers     MessageType = 0x9
 )
 
 type RPC struct {
@@ -68,7 +71,7 @@ func DefaultRPCDecodeFunc(rpc RPC) (*DecodeMessage, error) {
 	switch msg.Header {
 	case MessageTypeTx:
 		tx := new(core.Transaction)
-		if err := tx.Decode(core.NewGobTxDecoder(bytes.NewReader(msg.Data))); err != nil {
+		if err := tx.Decode(core.NewBinaryTxDecoder(bytes.NewReader(msg.Data))); err != nil {
 			return nil, err
 		}
 
@@ -79,7 +82,7 @@ func DefaultRPCDecodeFunc(rpc RPC) (*DecodeMessage, error) {
 
 	case MessageTypeBlock:
 		block := new(core.Block)
-		if err := block.Decode(core.NewGobBlockDecoder(bytes.NewReader(msg.Data))); err != nil {
+		if err := block.Decode(core.NewBinaryBlockDecoder(bytes.NewReader(msg.Data))); err != nil {
 			return nil, err
 		}
 
@@ -118,7 +121,7 @@ func DefaultRPCDecodeFunc(rpc RPC) (*DecodeMessage, error) {
 
 	case MessageTypeBlocks:
 		blocks := new(BlocksMessage)
-		if err := gob.NewDecoder(bytes.NewReader(msg.Data)).Decode(blocks); err != nil {
+		if err := core.NewBinaryBlocksDecoder(bytes.NewReader(msg.Data)).Decode(&blocks.Blocks); err != nil {
 			return nil, err
 		}
 
@@ -127,6 +130,34 @@ func DefaultRPCDecodeFunc(rpc RPC) (*DecodeMessage, error) {
 			Data: blocks,
 		}, nil
 
+	case MessageTypeHandshake:
+		handshake := new(HandshakeMessage)
+		if err := gob.NewDecoder(bytes.NewReader(msg.Data)).Decode(handshake); err != nil {
+			return nil, err
+		}
+
+		return &DecodeMessage{
+			From: rpc.From,
+			Data: handshake,
+		}, nil
+
+	case MessageTypeGetPeers:
+		return &DecodeMessage{
+			From: rpc.From,
+			Data: &GetPeersMessage{},
+		}, nil
+
+	case MessageTypePeers:
+		peers := new(PeersMessage)
+		if err := gob.NewDecoder(bytes.NewReader(msg.Data)).Decode(peers); err != nil {
+			return nil, err
+		}
+
+		return &DecodeMessage{
+			From: rpc.From,
+			Data: peers,
+		}, nil
+
 	default:
 		return nil, fmt.Errorf("unknown message header type: %x", msg.Header)
 	}
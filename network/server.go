@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"encoding/gob"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/dbkbali/bcbasic/api"
 	"github.com/dbkbali/bcbasic/core"
 	"github.com/dbkbali/bcbasic/crypto"
 	"github.com/dbkbali/bcbasic/types"
@@ -20,34 +23,76 @@ var defaultBlockTime = 5 * time.Second
 type ServerOptions struct {
 	SeedNodes     []string
 	ListenAddr    string
-	TCPTransport  *TCPTransport
-	ID            string
-	Logger        log.Logger
-	RPCDecodeFunc RPCDecodeFunc
-	RPCProcessor  RPCProcessor
-	BlockTime     time.Duration
-	PrivateKey    *crypto.PrivateKey
+	APIListenAddr string
+	// Transport connects the server to its peers. Defaults to a TCP
+	// transport listening on ListenAddr.
+	Transport Transport
+	ID        string
+	// ReconnectDelay is the first delay before a seed node is dialed again,
+	// it doubles with every failed attempt.
+	ReconnectDelay time.Duration
+	Logger         log.Logger
+	RPCDecodeFunc  RPCDecodeFunc
+	RPCProcessor   RPCProcessor
+	BlockTime      time.Duration
+	// PrivateKey signs the blocks of a validator node, with any scheme.
+	PrivateKey crypto.Signer
+	// KeystoreFile is an encrypted keystore holding the validator key. It is
+	// decrypted with KeystorePassword when PrivateKey is not set.
+	KeystoreFile     string
+	KeystorePassword string
+	// ChainID identifies the network. Blocks and transactions signed for
+	// another chain are rejected.
+	ChainID uint64
+	// GenesisAlloc funds accounts in the genesis block. Every node of a
+	// network must use the same allocation.
+	GenesisAlloc core.GenesisAlloc
+	// ForkChoice selects the canonical chain when validators produce
+	// competing blocks. Defaults to the longest chain.
+	ForkChoice core.ForkChoiceRule
+	// DataDir is where the node persists its blocks and the addresses of
+	// known peers. When empty both are only kept in memory.
+	DataDir string
+	// MaxOutboundPeers is the number of outgoing connections the node keeps
+	// to peers of its address book.
+	MaxOutboundPeers int
 }
 
 type Server struct {
-	TCPTransport *TCPTransport
-	peerCh       chan (*TCPPeer)
-
-	mu      sync.RWMutex
-	peerMap map[net.Addr]*TCPPeer
-
 	ServerOptions
-	memPool     *TxPool
-	chain       *core.Blockchain
+	nodeID      string
+	genesisHash types.Hash
+
+	mu    sync.RWMutex
+	peers map[string]*peerInfo
+	// addresses being dialed to reach MaxOutboundPeers
+	dialing map[string]bool
+	// addresses that turned out to be our own
+	ownAddrs             map[string]bool
+	addrBook             *AddrBook
+	dialInterval         time.Duration
+	peerExchangeInterval time.Duration
+
+	memPool *TxPool
+	chain   *core.Blockchain
+	// apiServer is nil when no APIListenAddr is set
+	apiServer   *api.Server
 	isValidator bool
-	rpcCh       chan RPC
-	quitCh      chan struct{} // options
+	// quitCh is closed by Stop
+	quitCh   chan struct{}
+	stopOnce sync.Once
 }
 
 func NewServer(options ServerOptions) (*Server, error) {
 	if options.BlockTime == time.Duration(0) {
 		options.BlockTime = defaultBlockTime
 	}
+	if options.MaxOutboundPeers == 0 {
+		options.MaxOutboundPeers = defaultMaxOutboundPeers
+	}
+	if options.ReconnectDelay == time.Duration(0) {
+		options.ReconnectDelay = defaultReconnectDelay
+	}
 	if options.RPCDecodeFunc == nil {
 		options.RPCDecodeFunc = DefaultRPCDecodeFunc
 	}
@@ -56,32 +101,91 @@ func NewServer(options ServerOptions) (*Server, error) {
 		options.Logger = log.With(options.Logger, "addr", options.ID)
 	}
 
-	chain, err := core.NewBlockchain(options.Logger, genesisBlock())
+	if options.PrivateKey == nil && options.KeystoreFile != "" {
+		privKey, err := crypto.LoadKeystore(options.KeystoreFile, options.KeystorePassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load validator key: %w", err)
+		}
+		options.PrivateKey = privKey
+	}
+
+	var store core.Storage = core.NewMemoryStore()
+	if options.DataDir != "" {
+		fileStore, err := core.NewFileStore(options.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+
+	addrBookPath := ""
+	if options.DataDir != "" {
+		addrBookPath = filepath.Join(options.DataDir, addrBookFile)
+	}
+	addrBook, err := NewAddrBook(addrBookPath)
 	if err != nil {
 		return nil, err
 	}
 
-	// apiServer :=
-	peerCh := make(chan *TCPPeer)
-	tr := NewTCPTransport(options.ListenAddr, peerCh)
-	s := &Server{
-		TCPTransport:  tr,
-		peerCh:        peerCh,
-		peerMap:       make(map[net.Addr]*TCPPeer),
-		ServerOptions: options,
-		chain:         chain,
-		memPool:       NewTxPool(1000),
-		isValidator:   options.PrivateKey != nil,
-		rpcCh:         make(chan RPC),
-		quitCh:        make(chan struct{}, 1),
+	genesis, err := genesisBlock(options.ChainID, options.GenesisAlloc)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := core.NewBlockchainWithStorage(options.Logger, store, genesis)
+	if err != nil {
+		return nil, err
 	}
 
-	s.TCPTransport.peerCh = peerCh
+	if options.ForkChoice != nil {
+		if err := chain.SetForkChoice(options.ForkChoice); err != nil {
+			return nil, err
+		}
+	}
+
+	var apiServer *api.Server
+	if len(options.APIListenAddr) > 0 {
+		apiServerCfg := api.ServerConfig{
+			Logger:     options.Logger,
+			ListenAddr: options.APIListenAddr,
+		}
+		apiServer = api.NewServer(apiServerCfg, chain)
+	}
+
+	if options.Transport == nil {
+		options.Transport = NewTCPTransport(options.ListenAddr)
+	}
+
+	genesisHash, err := genesisHash(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ServerOptions:        options,
+		nodeID:               newNodeID(),
+		genesisHash:          genesisHash,
+		peers:                make(map[string]*peerInfo),
+		dialing:              make(map[string]bool),
+		ownAddrs:             make(map[string]bool),
+		addrBook:             addrBook,
+		dialInterval:         defaultDialInterval,
+		peerExchangeInterval: defaultPeerExchangeInterval,
+		chain:                chain,
+		apiServer:            apiServer,
+		memPool:              NewTxPool(1000),
+		isValidator:          options.PrivateKey != nil,
+		quitCh:               make(chan struct{}),
+	}
+
+	s.memPool.SetNonceSource(chain)
 
 	if s.RPCProcessor == nil {
 		s.RPCProcessor = s
 	}
 
+	go s.reorgLoop(chain.SubscribeReorgs())
+
 	if s.isValidator {
 		go s.validatorLoop()
 	}
@@ -89,59 +193,67 @@ func NewServer(options ServerOptions) (*Server, error) {
 	return s, nil
 }
 
+// bootstrapNetwork dials the seed nodes, which needs a transport that can
+// dial addresses. Seeds that are not up yet are retried with backoff.
 func (s *Server) bootstrapNetwork() {
-	for _, addr := range s.SeedNodes {
-
-		go func(addr string) {
-
-			conn, err := net.Dial("tcp", addr)
-			if err != nil {
-				s.Logger.Log("err", err)
-				return
-			}
-
-			peer := &TCPPeer{
-				conn: conn,
-			}
-
-			s.peerCh <- peer
+	if len(s.SeedNodes) == 0 {
+		return
+	}
 
-		}(addr)
+	if _, ok := s.Transport.(Dialer); !ok {
+		s.Logger.Log("msg", "transport can not dial seed nodes", "transport", fmt.Sprintf("%T", s.Transport))
+		return
+	}
 
+	for _, addr := range s.SeedNodes {
+		go s.dialSeed(addr)
 	}
 }
 
 func (s *Server) Start() {
-	s.TCPTransport.Start()
+	if err := s.Transport.Start(); err != nil {
+		s.Logger.Log("msg", "failed to start transport", "err", err)
+		return
+	}
 
-	time.Sleep(time.Second * 2)
+	if s.apiServer != nil {
+		go func() {
+			if err := s.apiServer.Start(); err != nil {
+				s.Logger.Log("msg", "api server stopped", "err", err)
+			}
+		}()
+		s.Logger.Log("msg", "JSON API server running", "port", s.APIListenAddr)
+	}
 
 	s.bootstrapNetwork()
 
-	s.Logger.Log("accepting tcp on", s.ListenAddr, "id", s.ID)
+	go s.peerExchangeLoop()
+	if dialer, ok := s.Transport.(Dialer); ok {
+		go s.dialLoop(dialer)
+	}
+
+	s.Logger.Log("accepting on", s.Transport.Addr(), "id", s.ID)
 
 free:
 	for {
 		select {
-		case peer := <-s.peerCh:
-			s.peerMap[peer.conn.RemoteAddr()] = peer
-
-			go peer.readLoop(s.rpcCh)
-
-			if err := s.sendGetStatusMessage(peer); err != nil {
+		case ev := <-s.Transport.Peers():
+			if err := s.handlePeerEvent(ev); err != nil {
 				s.Logger.Log("err", err)
-				continue
 			}
 
-			s.Logger.Log("msg", "new peer added", "outgoing", peer.Outgoing, "addr", peer.conn.RemoteAddr())
-
-		case rpc := <-s.rpcCh:
+		case rpc := <-s.Transport.Consume():
 			msg, err := s.RPCDecodeFunc(rpc)
 			if err != nil {
 				s.Logger.Log("err", err)
 				continue
 			}
 
+			if _, ok := msg.Data.(*HandshakeMessage); !ok && !s.handshakeDone(msg.From) {
+				s.Logger.Log("msg", "dropped message from peer without handshake", "addr", msg.From)
+				continue
+			}
+
 			if err := s.RPCProcessor.ProcessMessage(msg); err != nil {
 				if err != core.ErrBlockKnown {
 					s.Logger.Log("err", err)
@@ -155,14 +267,67 @@ free:
 	s.Logger.Log("msg", "server stopped")
 }
 
+// Stop ends Start and the loops of the server, and closes the transport when
+// it can be closed.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quitCh)
+
+		if closer, ok := s.Transport.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				s.Logger.Log("err", err)
+			}
+		}
+	})
+}
+
 func (s *Server) validatorLoop() {
 	ticker := time.NewTicker(s.BlockTime)
+	defer ticker.Stop()
+
+	s.Logger.Log("msg", "Starting validator loop", "blockTime", s.BlockTime, "validator", s.PrivateKey.PublicKey().Address().Bech32(types.AddressPrefix(s.chain.ChainID())))
 
-	s.Logger.Log("msg", "Starting validator loop", "blockTime", s.BlockTime)
+	for {
+		select {
+		case <-ticker.C:
+			s.CreateNewBlock()
+		case <-s.quitCh:
+			return
+		}
+	}
+}
 
+// reorgLoop puts the transactions of blocks that were dropped from the
+// canonical chain back into the mempool so they can be included again.
+func (s *Server) reorgLoop(reorgs <-chan core.ReorgEvent) {
 	for {
-		<-ticker.C
-		s.CreateNewBlock()
+		var event core.ReorgEvent
+		select {
+		case event = <-reorgs:
+		case <-s.quitCh:
+			return
+		}
+
+		included := make(map[types.Hash]bool)
+		for _, b := range event.Connected {
+			for _, tx := range b.Transactions {
+				included[tx.Hash(core.TxHasher{})] = true
+			}
+		}
+
+		// Disconnected starts at the old tip, requeue from the oldest block so
+		// the nonces of a sender stay in order
+		dropped := []*core.Transaction{}
+		for i := len(event.Disconnected) - 1; i >= 0; i-- {
+			for _, tx := range event.Disconnected[i].Transactions {
+				if !included[tx.Hash(core.TxHasher{})] {
+					dropped = append(dropped, tx)
+				}
+			}
+		}
+		requeued := s.memPool.Requeue(dropped)
+
+		s.Logger.Log("msg", "chain reorganised", "new tip", event.NewTip, "disconnected", len(event.Disconnected), "requeued txs", requeued)
 	}
 }
 
@@ -172,6 +337,12 @@ func (s *Server) ProcessMessage(msg *DecodeMessage) error {
 		return s.processTransaction(t)
 	case *core.Block:
 		return s.processBlock(t)
+	case *HandshakeMessage:
+		return s.processHandshake(msg.From, t)
+	case *GetPeersMessage:
+		return s.processGetPeersMessage(msg.From, t)
+	case *PeersMessage:
+		return s.processPeersMessage(msg.From, t)
 	case *GetStatusMessage:
 		return s.processGetStatusMessage(msg.From, t)
 	case *StatusMessage:
@@ -186,85 +357,98 @@ func (s *Server) ProcessMessage(msg *DecodeMessage) error {
 	return nil
 }
 
-// GGG
+// A GetBlocks reply carries at most maxBlocksPerReply blocks and stops before
+// maxBlocksReplySize bytes, the requester asks for the next page once it
+// imported a reply.
+const (
+	maxBlocksPerReply  = 500
+	maxBlocksReplySize = 1 << 24
+)
+
+// processGetBlocksMessage replies with the blocks from data.From up to
+// data.To, or our tip when To is 0, one page at a time.
 func (s *Server) processGetBlocksMessage(from net.Addr, data *GetBlocksMessage) error {
 	s.Logger.Log("msg", "received GET BLOCKS msg", "from", from)
 
 	var (
-		blocks    = []*core.Block{}
-		ourHeight = s.chain.Height()
+		blocks  = []*core.Block{}
+		last    = s.chain.Height()
+		size    = 0
+		scratch = new(bytes.Buffer)
 	)
 
-	if data.To == 0 {
-		for i := int(data.From); i <= int(ourHeight); i++ {
-			block, err := s.chain.GetBlock(uint32(i))
-			if err != nil {
-				return err
-			}
+	if data.To != 0 && data.To < last {
+		last = data.To
+	}
 
-			blocks = append(blocks, block)
+	for i := int(data.From); i <= int(last) && len(blocks) < maxBlocksPerReply; i++ {
+		block, err := s.chain.GetBlock(uint32(i))
+		if err != nil {
+			return err
+		}
+
+		scratch.Reset()
+		if err := block.Encode(core.NewBinaryBlockEncoder(scratch)); err != nil {
+			return err
+		}
+		// the first block is always sent so the requester makes progress
+		if len(blocks) > 0 && size+scratch.Len() > maxBlocksReplySize {
+			break
 		}
-	}
 
-	blocksMsg := &BlocksMessage{
-		Blocks: blocks,
+		size += scratch.Len()
+		blocks = append(blocks, block)
 	}
 
 	buf := new(bytes.Buffer)
-	if err := gob.NewEncoder(buf).Encode(blocksMsg); err != nil {
+	if err := core.NewBinaryBlocksEncoder(buf).Encode(blocks); err != nil {
 		return err
 	}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	msg := NewMessage(MessageTypeBlocks, buf.Bytes())
-	peer, ok := s.peerMap[from]
-	if !ok {
-		return fmt.Errorf("peer not found")
-	}
-
-	return peer.Send(msg.Bytes())
-}
-
-func (s *Server) sendGetStatusMessage(peer *TCPPeer) error {
-	var (
-		getStatusMsg = new(GetStatusMessage)
-		buf          = new(bytes.Buffer)
-	)
 
-	if err := gob.NewEncoder(buf).Encode(getStatusMsg); err != nil {
-		return err
-	}
-
-	msg := NewMessage(MessageTypeGetStatus, buf.Bytes())
-	return peer.Send(msg.Bytes())
+	return s.Transport.SendMessage(from, msg.Bytes())
 }
 
+// broadcast sends payload to every peer that completed the handshake, the
+// others drop it anyway.
 func (s *Server) broadcast(payload []byte) error {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	for netAddr, peer := range s.peerMap {
-		if err := peer.Send(payload); err != nil {
-			s.Logger.Log("err", err, "addr", netAddr)
+	peers := make([]net.Addr, 0, len(s.peers))
+	for _, p := range s.peers {
+		if p.handshake != nil {
+			peers = append(peers, p.addr)
 		}
+	}
+	s.mu.RUnlock()
 
+	for _, addr := range peers {
+		if err := s.Transport.SendMessage(addr, payload); err != nil {
+			s.Logger.Log("err", err, "addr", addr)
+		}
 	}
+
 	return nil
 }
 
 func (s *Server) processBlocksMessage(from net.Addr, data *BlocksMessage) error {
 	s.Logger.Log("msg", "received BLOCKS !!!!!", "from", from)
 
+	height := s.chain.Height()
 	for _, block := range data.Blocks {
 		if err := s.chain.AddBlock(block); err != nil {
 			fmt.Printf("BLOCK ERROR: %s\n", err)
 			continue
 			// s.Logger.Log("err", err)
 		}
+		s.memPool.RemovePending(block.Transactions)
 	}
 
-	return nil
+	if len(data.Blocks) == 0 || s.chain.Height() <= height {
+		return nil
+	}
+
+	return s.sendGetBlocksMessage(from)
 }
 
 func (s *Server) processStatusMessage(from net.Addr, data *StatusMessage) error {
@@ -275,7 +459,7 @@ func (s *Server) processStatusMessage(from net.Addr, data *StatusMessage) error
 	}
 
 	// this remote has blocks we can sync
-	go s.requestBlocksLoop(from)
+	s.syncFrom(from)
 	return nil
 }
 
@@ -285,6 +469,7 @@ func (s *Server) processGetStatusMessage(from net.Addr, data *GetStatusMessage)
 	statusMsg := &StatusMessage{
 		CurrentHeight: s.chain.Height(),
 		ID:            s.ID,
+		Version:       protocolVersion,
 	}
 
 	buf := new(bytes.Buffer)
@@ -292,23 +477,16 @@ func (s *Server) processGetStatusMessage(from net.Addr, data *GetStatusMessage)
 		return err
 	}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	peer, ok := s.peerMap[from]
-	if !ok {
-		return fmt.Errorf("peer not found")
-	}
-
 	msg := NewMessage(MessageTypeStatus, buf.Bytes())
 
-	return peer.Send(msg.Bytes())
+	return s.Transport.SendMessage(from, msg.Bytes())
 }
 
 func (s *Server) processBlock(b *core.Block) error {
 	if err := s.chain.AddBlock(b); err != nil {
 		return err
 	}
+	s.memPool.RemovePending(b.Transactions)
 
 	go s.broadcastBlock(b)
 
@@ -322,7 +500,11 @@ func (s *Server) processTransaction(tx *core.Transaction) error {
 		return nil
 	}
 
-	if err := tx.Verify(); err != nil {
+	if tx.ChainID != s.chain.ChainID() {
+		return fmt.Errorf("%w: tx [%s] chain id [%d] expected [%d]", core.ErrChainIDMismatch, hash, tx.ChainID, s.chain.ChainID())
+	}
+
+	if err := s.chain.VerifyTransaction(tx); err != nil {
 		return err
 	}
 
@@ -332,50 +514,79 @@ func (s *Server) processTransaction(tx *core.Transaction) error {
 	// 	"mempool len", s.memPool.PendingCount(),
 	// )
 
+	if err := s.memPool.Add(tx); err != nil {
+		return err
+	}
+
 	go s.broadcastTx(tx)
 
-	s.memPool.Add(tx)
 	return nil
 }
 
+// syncFrom starts requesting blocks from peer, unless a sync from it is
+// already running.
+func (s *Server) syncFrom(peer net.Addr) {
+	s.mu.Lock()
+	p, ok := s.peers[peer.String()]
+	if !ok || p.handshake == nil || p.syncing {
+		s.mu.Unlock()
+		return
+	}
+	p.syncing = true
+	s.mu.Unlock()
+
+	go s.requestBlocksLoop(p)
+}
+
+// requestBlocksLoop asks p for the blocks above our height until p
+// disconnects.
 // TODO: stop syncing when at highest block
-func (s *Server) requestBlocksLoop(peer net.Addr) error {
+func (s *Server) requestBlocksLoop(p *peerInfo) {
 	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
 
 	for {
-		ourHeight := s.chain.Height()
-		s.Logger.Log("msg", "requesting blocks", "requesting height", ourHeight+1, "addr", peer)
-		// this remote has blocks we can sync
-		getBlocksMsg := &GetBlocksMessage{
-			From: ourHeight + 1,
-			To:   0,
+		s.mu.RLock()
+		connected := s.peers[p.addr.String()] == p
+		s.mu.RUnlock()
+		if !connected {
+			return
 		}
 
-		buf := new(bytes.Buffer)
-		if err := gob.NewEncoder(buf).Encode(getBlocksMsg); err != nil {
-			return err
+		if err := s.sendGetBlocksMessage(p.addr); err != nil {
+			s.Logger.Log("error", "failed to send to peer", "err", err, "peer", p.addr)
 		}
 
-		s.mu.RLock()
-		defer s.mu.RUnlock()
-
-		msg := NewMessage(MessageTypeGetBlocks, buf.Bytes())
-		peer, ok := s.peerMap[peer]
-		if !ok {
-			return fmt.Errorf("peer %+s not found", peer.conn.RemoteAddr())
+		select {
+		case <-ticker.C:
+		case <-s.quitCh:
+			return
 		}
+	}
+}
 
-		if err := peer.Send(msg.Bytes()); err != nil {
-			s.Logger.Log("error", "failed to send to peer", "err", err, "peer", peer.conn.RemoteAddr())
-		}
+// sendGetBlocksMessage asks peer for the blocks above our height.
+func (s *Server) sendGetBlocksMessage(peer net.Addr) error {
+	ourHeight := s.chain.Height()
+	s.Logger.Log("msg", "requesting blocks", "requesting height", ourHeight+1, "addr", peer)
 
-		<-ticker.C
+	getBlocksMsg := &GetBlocksMessage{
+		From: ourHeight + 1,
+		To:   0,
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(getBlocksMsg); err != nil {
+		return err
 	}
+
+	msg := NewMessage(MessageTypeGetBlocks, buf.Bytes())
+	return s.Transport.SendMessage(peer, msg.Bytes())
 }
 
 func (s *Server) broadcastBlock(b *core.Block) error {
 	buf := &bytes.Buffer{}
-	if err := b.Encode(core.NewGobBlockEncoder(buf)); err != nil {
+	if err := b.Encode(core.NewBinaryBlockEncoder(buf)); err != nil {
 		return err
 	}
 
@@ -386,7 +597,7 @@ func (s *Server) broadcastBlock(b *core.Block) error {
 
 func (s *Server) broadcastTx(tx *core.Transaction) error {
 	buf := &bytes.Buffer{}
-	if err := tx.Encode(core.NewGobTxEncoder(buf)); err != nil {
+	if err := tx.Encode(core.NewBinaryTxEncoder(buf)); err != nil {
 		return err
 	}
 
@@ -405,14 +616,20 @@ func (s *Server) CreateNewBlock() error {
 
 	// TODO: change from adding all txs to pool - limit via some function later
 	// To match the tx types
-	txx := s.memPool.Pending()
+	pending := s.memPool.Pending()
+
+	txx, stateRoot, err := s.chain.PrepareBlock(core.BlockHasher{}.Hash(currentHeader), pending)
+	if err != nil {
+		return err
+	}
 
 	block, err := core.NewBlockFromPrevHeader(currentHeader, txx)
 	if err != nil {
 		return err
 	}
+	block.StateRoot = stateRoot
 
-	if err := block.Sign(*s.PrivateKey); err != nil {
+	if err := block.Sign(s.PrivateKey); err != nil {
 		return err
 	}
 
@@ -420,27 +637,32 @@ func (s *Server) CreateNewBlock() error {
 		return err
 	}
 
-	s.memPool.ClearPending()
+	// the pending transactions left out of the block are invalid
+	s.memPool.RemovePending(pending)
 
 	go s.broadcastBlock(block)
 
 	return nil
 }
 
-func genesisBlock() *core.Block {
+func genesisBlock(chainID uint64, alloc core.GenesisAlloc) (*core.Block, error) {
 	header := &core.Header{
 		Version:   1,
+		ChainID:   chainID,
 		DataHash:  types.Hash{},
 		Height:    0,
 		Timestamp: 000000,
 	}
 
-	b, _ := core.NewBlock(header, nil)
+	b, err := core.NewGenesisBlock(header, alloc)
+	if err != nil {
+		return nil, err
+	}
 
 	privKey := crypto.GeneratePrivateKey()
 	if err := b.Sign(privKey); err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return b
+	return b, nil
 }
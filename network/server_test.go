@@ -0,0 +1,179 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dbkbali/bcbasic/core"
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalClusterSyncsBlocksAndTxs(t *testing.T) {
+	var (
+		trA = NewLocalTransport(NetAddress("A"))
+		trB = NewLocalTransport(NetAddress("B"))
+		trC = NewLocalTransport(NetAddress("C"))
+	)
+	connectAll(t, trA, trB, trC)
+
+	validator := newLocalServer(t, "A", trA, crypto.GeneratePrivateKey())
+	nodeB := newLocalServer(t, "B", trB, nil)
+	nodeC := newLocalServer(t, "C", trC, nil)
+
+	for _, s := range []*Server{validator, nodeB, nodeC} {
+		go s.Start()
+	}
+	waitForHandshakes(t, validator, nodeB, nodeC)
+
+	// a transaction sent to B reaches the validator and is included in a
+	// block every node imports
+	tx := core.NewTransaction(nil)
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	buf := &bytes.Buffer{}
+	assert.Nil(t, tx.Encode(core.NewBinaryTxEncoder(buf)))
+	assert.Nil(t, trA.SendMessage(trB.Addr(), NewMessage(MessageTypeTx, buf.Bytes()).Bytes()))
+
+	hash := tx.Hash(core.TxHasher{})
+	for _, s := range []*Server{validator, nodeB, nodeC} {
+		chain := s.chain
+		assert.Eventually(t, func() bool {
+			_, err := chain.GetTransaction(hash)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond, s.ID)
+	}
+
+	assert.Eventually(t, func() bool {
+		return nodeC.chain.Height() >= 2 && nodeB.chain.Height() >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// waitForHandshakes waits until every server accepted the handshake of every
+// other server, messages of peers without a handshake are dropped.
+func waitForHandshakes(t *testing.T, servers ...*Server) {
+	for _, a := range servers {
+		for _, b := range servers {
+			if a == b {
+				continue
+			}
+
+			a, addr := a, b.Transport.Addr()
+			assert.Eventually(t, func() bool {
+				return a.handshakeDone(addr)
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+	}
+}
+
+func newLocalServer(t *testing.T, id string, tr Transport, privKey crypto.Signer) *Server {
+	s, err := NewServer(ServerOptions{
+		ID:         id,
+		Transport:  tr,
+		PrivateKey: privKey,
+		BlockTime:  50 * time.Millisecond,
+		Logger:     log.NewNopLogger(),
+	})
+	assert.Nil(t, err)
+
+	return s
+}
+
+func connectAll(t *testing.T, trs ...*LocalTransport) {
+	for _, a := range trs {
+		for _, b := range trs {
+			if a != b {
+				assert.Nil(t, a.Connect(b))
+			}
+		}
+	}
+}
+
+func TestGetBlocksRepliesArePaged(t *testing.T) {
+	var (
+		trA = NewLocalTransport(NetAddress("A"))
+		trB = NewLocalTransport(NetAddress("B"))
+	)
+	connectAll(t, trA, trB)
+
+	s := newLocalServer(t, "A", trA, nil)
+	s.PrivateKey = crypto.GeneratePrivateKey()
+	for i := 0; i < maxBlocksPerReply+10; i++ {
+		assert.Nil(t, s.CreateNewBlock())
+	}
+
+	assert.Nil(t, s.processGetBlocksMessage(trB.Addr(), &GetBlocksMessage{From: 1}))
+	assert.Len(t, receiveBlocks(t, trB), maxBlocksPerReply)
+
+	assert.Nil(t, s.processGetBlocksMessage(trB.Addr(), &GetBlocksMessage{From: maxBlocksPerReply + 1}))
+	assert.Len(t, receiveBlocks(t, trB), 10)
+
+	assert.Nil(t, s.processGetBlocksMessage(trB.Addr(), &GetBlocksMessage{From: 1, To: 3}))
+	assert.Len(t, receiveBlocks(t, trB), 3)
+}
+
+// receiveBlocks returns the blocks of the next BlocksMessage tr receives,
+// skipping the blocks broadcast on creation.
+func receiveBlocks(t *testing.T, tr *LocalTransport) []*core.Block {
+	for rpc := range tr.Consume() {
+		msg, err := DefaultRPCDecodeFunc(rpc)
+		assert.Nil(t, err)
+
+		if blocks, ok := msg.Data.(*BlocksMessage); ok {
+			return blocks.Blocks
+		}
+	}
+
+	return nil
+}
+
+func TestBroadcastSkipsPeersWithoutHandshake(t *testing.T) {
+	var (
+		trA = NewLocalTransport(NetAddress("A"))
+		trB = NewLocalTransport(NetAddress("B"))
+		trC = NewLocalTransport(NetAddress("C"))
+	)
+	connectAll(t, trA, trB, trC)
+
+	s := newLocalServer(t, "A", trA, nil)
+	s.peers[trB.Addr().String()] = &peerInfo{addr: trB.Addr(), handshake: &HandshakeMessage{}}
+	s.peers[trC.Addr().String()] = &peerInfo{addr: trC.Addr()}
+
+	assert.Nil(t, s.broadcast([]byte("foo")))
+	assert.Len(t, trB.Consume(), 1)
+	assert.Len(t, trC.Consume(), 0)
+}
+
+func TestReorgRequeuesDroppedTxs(t *testing.T) {
+	s := newLocalServer(t, "A", NewLocalTransport(NetAddress("A")), nil)
+	s.PrivateKey = crypto.GeneratePrivateKey()
+
+	genesis, err := s.chain.GetHeader(0)
+	assert.Nil(t, err)
+
+	tx := core.NewTransaction([]byte("foo"))
+	assert.Nil(t, tx.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, s.memPool.Add(tx))
+	assert.Nil(t, s.CreateNewBlock())
+	assert.Equal(t, 0, s.memPool.PendingCount())
+
+	// a longer branch without the transaction replaces the block holding it
+	prev := genesis
+	for i := 0; i < 2; i++ {
+		b, err := core.NewBlockFromPrevHeader(prev, nil)
+		assert.Nil(t, err)
+		b.StateRoot = genesis.StateRoot
+		assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+		assert.Nil(t, s.chain.AddBlock(b))
+		prev = b.Header
+	}
+	assert.Equal(t, uint32(2), s.chain.Height())
+
+	assert.Eventually(t, func() bool {
+		return s.memPool.PendingCount() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, tx.Hash(core.TxHasher{}), s.memPool.Pending()[0].Hash(core.TxHasher{}))
+
+	s.Stop()
+}
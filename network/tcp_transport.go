@@ -1,72 +1,80 @@
 package network
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"net"
+	"sync"
 )
 
 type TCPPeer struct {
 	conn     net.Conn
 	Outgoing bool
+	// dialed is the address an outgoing connection was dialed with
+	dialed string
+	// writeLock keeps frames sent from different goroutines apart
+	writeLock sync.Mutex
 }
 
+// Send writes payload to the peer as a single frame.
 func (p *TCPPeer) Send(payload []byte) error {
-	_, err := p.conn.Write(payload)
-	return err
-}
-
-func (t *TCPTransport) acceptLoop() {
-	for {
-		conn, err := t.listener.Accept()
-		if err != nil {
-			fmt.Printf("Error accepting connection from [%+v]\n", conn)
-			continue
-		}
-
-		peer := &TCPPeer{
-			conn: conn,
-		}
-
-		t.peerCh <- peer
-
-		fmt.Printf("Accepted connection from [%+v]\n", peer.conn)
-
-	}
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
 
+	return writeFrame(p.conn, payload)
 }
 
-func (p *TCPPeer) readLoop(rpcCh chan RPC) {
-	buf := make([]byte, 4096)
+// readLoop delivers every frame read from the peer as an RPC. The connection
+// is closed on the first error, a stream can not be resynchronised after a
+// bad frame or once quitCh is closed.
+func (p *TCPPeer) readLoop(rpcCh chan RPC, quitCh chan struct{}) {
+	defer p.conn.Close()
+
+	r := bufio.NewReader(p.conn)
 	for {
-		n, err := p.conn.Read(buf)
-		if err == io.EOF {
-			continue
-		}
+		msg, err := readFrame(r)
 		if err != nil {
-			fmt.Printf("Error reading from [%+v]\n", p.conn)
-			continue
+			if err != io.EOF {
+				fmt.Printf("Error reading from [%+v]: %s\n", p.conn.RemoteAddr(), err)
+			}
+			return
 		}
 
-		msg := buf[:n]
-		rpcCh <- RPC{
+		select {
+		case rpcCh <- RPC{
 			From:    p.conn.RemoteAddr(),
 			Payload: bytes.NewReader(msg),
+		}:
+		case <-quitCh:
+			return
 		}
 	}
 }
 
+// TCPTransport connects to peers over TCP. Peers are identified by the
+// remote address of their connection.
 type TCPTransport struct {
-	peerCh     chan *TCPPeer
 	listenAddr string
 	listener   net.Listener
+	rpcCh      chan RPC
+	peerCh     chan PeerEvent
+	// quitCh is closed by Close, nobody reads rpcCh and peerCh after that
+	quitCh    chan struct{}
+	closeOnce sync.Once
+
+	lock  sync.RWMutex
+	peers map[string]*TCPPeer
 }
 
-func NewTCPTransport(addr string, peerCh chan *TCPPeer) *TCPTransport {
+func NewTCPTransport(addr string) *TCPTransport {
 	return &TCPTransport{
-		peerCh:     peerCh,
 		listenAddr: addr,
+		rpcCh:      make(chan RPC, 1024),
+		peerCh:     make(chan PeerEvent, 1024),
+		quitCh:     make(chan struct{}),
+		peers:      make(map[string]*TCPPeer),
 	}
 }
 
@@ -76,11 +84,190 @@ func (t *TCPTransport) Start() error {
 		return err
 	}
 
+	t.lock.Lock()
 	t.listener = ln
+	t.lock.Unlock()
 
 	go t.acceptLoop()
 
-	fmt.Println("TCP TRANSPORT: Listening on port:", t.listenAddr)
+	fmt.Println("TCP TRANSPORT: Listening on port:", ln.Addr())
+
+	return nil
+}
+
+func (t *TCPTransport) acceptLoop() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+
+		t.addPeer(&TCPPeer{conn: conn})
+
+		fmt.Printf("Accepted connection from [%+v]\n", conn.RemoteAddr())
+	}
+}
+
+// Dial connects to the transport listening on addr.
+func (t *TCPTransport) Dial(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	t.addPeer(&TCPPeer{conn: conn, Outgoing: true, dialed: addr})
+
+	return nil
+}
+
+func (t *TCPTransport) addPeer(peer *TCPPeer) {
+	t.lock.Lock()
+	t.peers[peer.conn.RemoteAddr().String()] = peer
+	t.lock.Unlock()
+
+	if !t.notify(peer.event(false)) {
+		peer.conn.Close()
+	}
+
+	go func() {
+		peer.readLoop(t.rpcCh, t.quitCh)
+		t.removePeer(peer)
+	}()
+}
+
+// removePeer forgets peer once its connection is closed, after a read error,
+// a failed write or Disconnect.
+func (t *TCPTransport) removePeer(peer *TCPPeer) {
+	key := peer.conn.RemoteAddr().String()
+
+	t.lock.Lock()
+	if t.peers[key] == peer {
+		delete(t.peers, key)
+	}
+	t.lock.Unlock()
+
+	t.notify(peer.event(true))
+}
+
+// notify reports ev on Peers. It gives up once the transport is closed, as
+// nobody reads the events any more.
+func (t *TCPTransport) notify(ev PeerEvent) bool {
+	select {
+	case t.peerCh <- ev:
+		return true
+	case <-t.quitCh:
+		return false
+	}
+}
+
+// Close stops accepting connections and closes the connections to all peers.
+func (t *TCPTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.quitCh)
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		if t.listener != nil {
+			err = t.listener.Close()
+		}
+		for _, peer := range t.peers {
+			peer.conn.Close()
+		}
+	})
+
+	return err
+}
+
+func (p *TCPPeer) event(disconnected bool) PeerEvent {
+	return PeerEvent{
+		Addr:         p.conn.RemoteAddr(),
+		Outgoing:     p.Outgoing,
+		Dialed:       p.dialed,
+		Disconnected: disconnected,
+	}
+}
+
+func (t *TCPTransport) Consume() <-chan RPC {
+	return t.rpcCh
+}
+
+func (t *TCPTransport) Peers() <-chan PeerEvent {
+	return t.peerCh
+}
+
+// Connect dials the address of tr.
+func (t *TCPTransport) Connect(tr Transport) error {
+	return t.Dial(tr.Addr().String())
+}
+
+func (t *TCPTransport) Disconnect(addr net.Addr) error {
+	t.lock.RLock()
+	peer, ok := t.peers[addr.String()]
+	t.lock.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%s: no peer with address %s", t.Addr(), addr)
+	}
+
+	return peer.conn.Close()
+}
+
+func (t *TCPTransport) SendMessage(addr net.Addr, payload []byte) error {
+	t.lock.RLock()
+	peer, ok := t.peers[addr.String()]
+	t.lock.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%s: no peer with address %s", t.Addr(), addr)
+	}
+
+	return t.send(peer, payload)
+}
+
+// send writes payload to peer and closes the connection when that fails, so
+// the peer is removed.
+func (t *TCPTransport) send(peer *TCPPeer, payload []byte) error {
+	if err := peer.Send(payload); err != nil {
+		peer.conn.Close()
+		return fmt.Errorf("failed to send to [%s]: %w", peer.conn.RemoteAddr(), err)
+	}
 
 	return nil
 }
+
+// Broadcast sends payload to every peer and returns the first error.
+func (t *TCPTransport) Broadcast(payload []byte) error {
+	t.lock.RLock()
+	peers := make([]*TCPPeer, 0, len(t.peers))
+	for _, peer := range t.peers {
+		peers = append(peers, peer)
+	}
+	t.lock.RUnlock()
+
+	var firstErr error
+	for _, peer := range peers {
+		if err := t.send(peer, payload); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Addr returns the address the transport listens on, which is only resolved
+// once it is started.
+func (t *TCPTransport) Addr() net.Addr {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.listener != nil {
+		return t.listener.Addr()
+	}
+
+	return NetAddress(t.listenAddr)
+}
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPTransportConnectAndSend(t *testing.T) {
+	var a, b Transport = NewTCPTransport("127.0.0.1:0"), NewTCPTransport("127.0.0.1:0")
+	assert.Nil(t, a.Start())
+	assert.Nil(t, b.Start())
+
+	assert.Nil(t, a.Connect(b))
+
+	outgoing := <-a.Peers()
+	assert.True(t, outgoing.Outgoing)
+	incoming := <-b.Peers()
+	assert.False(t, incoming.Outgoing)
+
+	assert.Nil(t, a.SendMessage(outgoing.Addr, []byte("ping")))
+	rpc := <-b.Consume()
+	payload, _ := io.ReadAll(rpc.Payload)
+	assert.Equal(t, []byte("ping"), payload)
+
+	// b answers on the connection a opened
+	assert.Nil(t, b.SendMessage(rpc.From, []byte("pong")))
+	rpc = <-a.Consume()
+	payload, _ = io.ReadAll(rpc.Payload)
+	assert.Equal(t, []byte("pong"), payload)
+
+	assert.Nil(t, b.Broadcast([]byte("all")))
+	rpc = <-a.Consume()
+	payload, _ = io.ReadAll(rpc.Payload)
+	assert.Equal(t, []byte("all"), payload)
+}
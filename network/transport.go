@@ -2,12 +2,39 @@ package network
 
 import "net"
 
+// NetAddress is the address of an in-process transport.
 type NetAddress string
 
+func (a NetAddress) Network() string { return "local" }
+func (a NetAddress) String() string  { return string(a) }
+
+// PeerEvent reports a peer connecting to or disconnecting from a transport.
+type PeerEvent struct {
+	Addr     net.Addr
+	Outgoing bool
+	// Dialed is the address an outgoing connection was dialed with, which
+	// can differ from the resolved Addr.
+	Dialed       string
+	Disconnected bool
+}
+
 type Transport interface {
+	// Start makes the transport accept connections from other transports.
+	Start() error
 	Consume() <-chan RPC
+	// Peers delivers an event for every peer that connects or disconnects.
+	Peers() <-chan PeerEvent
 	Connect(Transport) error
+	// Disconnect drops the connection to the peer at addr, the disconnect
+	// is reported on Peers.
+	Disconnect(net.Addr) error
 	SendMessage(net.Addr, []byte) error
 	Broadcast([]byte) error
 	Addr() net.Addr
 }
+
+// Dialer is implemented by transports that can connect to a peer they only
+// know the address of, such as a seed node.
+type Dialer interface {
+	Dial(addr string) error
+}
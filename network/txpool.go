@@ -7,12 +7,22 @@ import (
 	"github.com/dbkbali/bcbasic/types"
 )
 
+// NonceSource returns the next nonce the chain expects from an address.
+type NonceSource interface {
+	NextNonce(addr types.Address) uint64
+}
+
 type TxPool struct {
 	all     *TxSortedMap
 	pending *TxSortedMap
 	// The maxLength of the total pool of transactions.
 	// When the pool is full we will prune the oldest transaction.
 	maxLength int
+
+	nonceLock sync.Mutex
+	nonces    NonceSource
+	// next nonce of every sender with pending transactions
+	pendingNonces map[types.Address]uint64
 }
 
 func NewTxPool(maxLength int) *TxPool {
@@ -20,20 +30,63 @@ func NewTxPool(maxLength int) *TxPool {
 		all:       NewTxSortedMap(),
 		pending:   NewTxSortedMap(),
 		maxLength: maxLength,
+
+		pendingNonces: make(map[types.Address]uint64),
 	}
 }
 
-func (p *TxPool) Add(tx *core.Transaction) {
+// SetNonceSource makes the pool reject transactions whose nonce does not
+// directly follow the chain's next nonce and the pending transactions of
+// the same sender. Without a source nonces are not checked.
+func (p *TxPool) SetNonceSource(src NonceSource) {
+	p.nonceLock.Lock()
+	defer p.nonceLock.Unlock()
+
+	p.nonces = src
+}
+
+func (p *TxPool) Add(tx *core.Transaction) error {
+	if p.all.Contains(tx.Hash(core.TxHasher{})) {
+		return nil
+	}
+
+	if err := p.useNonce(tx); err != nil {
+		return err
+	}
+
 	// prune the oldest transaction that is sitting in the all pool
 	if p.all.Count() == p.maxLength {
 		oldest := p.all.First()
 		p.all.Remove(oldest.Hash(core.TxHasher{}))
 	}
 
-	if !p.all.Contains(tx.Hash(core.TxHasher{})) {
-		p.all.Add(tx)
-		p.pending.Add(tx)
+	p.all.Add(tx)
+	p.pending.Add(tx)
+
+	return nil
+}
+
+func (p *TxPool) useNonce(tx *core.Transaction) error {
+	p.nonceLock.Lock()
+	defer p.nonceLock.Unlock()
+
+	if p.nonces == nil {
+		return nil
+	}
+
+	sender := tx.Sender()
+	expected, ok := p.pendingNonces[sender]
+	if !ok {
+		expected = p.nonces.NextNonce(sender)
+	}
+
+	if err := core.CheckNonce(sender, expected, tx.Nonce); err != nil {
+		return err
 	}
+
+	p.pendingNonces[sender] = expected + 1
+
+	return nil
 }
 
 func (p *TxPool) Contains(hash types.Hash) bool {
@@ -42,11 +95,86 @@ func (p *TxPool) Contains(hash types.Hash) bool {
 
 // Pending returns a slice of transactions that are in the pending pool
 func (p *TxPool) Pending() []*core.Transaction {
-	return p.pending.txx.Data
+	return p.pending.Transactions()
+}
+
+// RemovePending drops txx, the transactions of a block added to the chain,
+// from the pending pool. Senders of txx without pending transactions left get
+// their next nonce from the chain again; the nonces of other senders are kept.
+func (p *TxPool) RemovePending(txx []*core.Transaction) {
+	p.nonceLock.Lock()
+	defer p.nonceLock.Unlock()
+
+	senders := make(map[types.Address]struct{}, len(txx))
+	for _, tx := range txx {
+		p.pending.Remove(tx.Hash(core.TxHasher{}))
+		senders[tx.Sender()] = struct{}{}
+	}
+
+	for _, tx := range p.pending.Transactions() {
+		delete(senders, tx.Sender())
+	}
+	for sender := range senders {
+		delete(p.pendingNonces, sender)
+	}
 }
 
-func (p *TxPool) ClearPending() {
+// Requeue puts txx, the transactions of blocks dropped from the canonical
+// chain, back into the pending pool ahead of the transactions pending already.
+// The next nonce of their senders is rewound to follow the chain again. It
+// returns the number of transactions that were not pending yet.
+func (p *TxPool) Requeue(txx []*core.Transaction) int {
+	p.nonceLock.Lock()
+	defer p.nonceLock.Unlock()
+
+	pending := p.pending.Transactions()
+	requeued := make([]*core.Transaction, 0, len(txx))
+	senders := make(map[types.Address]struct{}, len(txx))
+	for _, tx := range txx {
+		hash := tx.Hash(core.TxHasher{})
+		if p.pending.Contains(hash) {
+			continue
+		}
+
+		if !p.all.Contains(hash) {
+			if p.all.Count() == p.maxLength {
+				p.all.Remove(p.all.First().Hash(core.TxHasher{}))
+			}
+			p.all.Add(tx)
+		}
+
+		requeued = append(requeued, tx)
+		senders[tx.Sender()] = struct{}{}
+	}
+
 	p.pending.Clear()
+	for _, tx := range append(requeued, pending...) {
+		p.pending.Add(tx)
+	}
+
+	for sender := range senders {
+		delete(p.pendingNonces, sender)
+	}
+	if p.nonces == nil {
+		return len(requeued)
+	}
+
+	for _, tx := range p.pending.Transactions() {
+		sender := tx.Sender()
+		if _, ok := senders[sender]; !ok {
+			continue
+		}
+
+		next, ok := p.pendingNonces[sender]
+		if !ok {
+			next = p.nonces.NextNonce(sender)
+		}
+		if tx.Nonce == next {
+			p.pendingNonces[sender] = next + 1
+		}
+	}
+
+	return len(requeued)
 }
 
 func (p *TxPool) PendingCount() int {
@@ -97,10 +225,25 @@ func (t *TxSortedMap) Remove(h types.Hash) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
-	t.txx.Remove(t.lookup[h])
+	tx, ok := t.lookup[h]
+	if !ok {
+		return
+	}
+
+	t.txx.Remove(tx)
 	delete(t.lookup, h)
 }
 
+// Transactions returns a copy of the transactions in insertion order.
+func (t *TxSortedMap) Transactions() []*core.Transaction {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	txx := make([]*core.Transaction, len(t.txx.Data))
+	copy(txx, t.txx.Data)
+	return txx
+}
+
 func (t *TxSortedMap) Count() int {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/dbkbali/bcbasic/core"
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/dbkbali/bcbasic/types"
 	"github.com/dbkbali/bcbasic/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -105,3 +107,123 @@ func TestTxSortedMapRemove(t *testing.T) {
 	assert.Equal(t, m.Count(), 0)
 	assert.False(t, m.Contains(tx.Hash(core.TxHasher{})))
 }
+
+type nonceMap map[types.Address]uint64
+
+func (m nonceMap) NextNonce(addr types.Address) uint64 {
+	return m[addr]
+}
+
+func TestTxPoolNonces(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+
+	p := NewTxPool(10)
+	chain := nonceMap{sender: 1}
+	p.SetNonceSource(chain)
+
+	newTx := func(nonce uint64) *core.Transaction {
+		tx := utils.NewRandomTransaction(10)
+		tx.Nonce = nonce
+		assert.Nil(t, tx.Sign(privKey))
+		return tx
+	}
+
+	assert.ErrorIs(t, p.Add(newTx(0)), core.ErrNonceTooLow)
+	assert.ErrorIs(t, p.Add(newTx(2)), core.ErrNonceTooHigh)
+	first := newTx(1)
+	assert.Nil(t, p.Add(first))
+	second := newTx(2)
+	assert.Nil(t, p.Add(second))
+	// the nonce is taken by a pending transaction
+	assert.ErrorIs(t, p.Add(newTx(2)), core.ErrNonceTooLow)
+	assert.Equal(t, 2, p.PendingCount())
+
+	// a block includes the first transaction, the second is still pending
+	chain[sender] = 2
+	p.RemovePending([]*core.Transaction{first})
+	assert.Equal(t, 1, p.PendingCount())
+	assert.ErrorIs(t, p.Add(newTx(2)), core.ErrNonceTooLow)
+	assert.Nil(t, p.Add(newTx(3)))
+
+	// with nothing pending the chain decides again
+	p.RemovePending(p.Pending())
+	assert.Equal(t, 0, p.PendingCount())
+	assert.Nil(t, p.Add(newTx(2)))
+}
+
+func TestTxPoolRemovePendingKeepsOtherSenders(t *testing.T) {
+	a, b := crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()
+
+	p := NewTxPool(10)
+	p.SetNonceSource(nonceMap{})
+
+	newTx := func(privKey crypto.PrivateKey, nonce uint64) *core.Transaction {
+		tx := utils.NewRandomTransaction(10)
+		tx.Nonce = nonce
+		assert.Nil(t, tx.Sign(privKey))
+		return tx
+	}
+
+	txA := newTx(a, 0)
+	assert.Nil(t, p.Add(txA))
+	assert.Nil(t, p.Add(newTx(b, 0)))
+
+	p.RemovePending([]*core.Transaction{txA})
+	assert.Equal(t, 1, p.PendingCount())
+	// the pending nonce of b is still tracked
+	assert.ErrorIs(t, p.Add(newTx(b, 0)), core.ErrNonceTooLow)
+	assert.Nil(t, p.Add(newTx(b, 1)))
+}
+
+func TestTxPoolSamePayloadFromTwoSenders(t *testing.T) {
+	p := NewTxPool(10)
+
+	a := core.NewTransaction([]byte("foobar"))
+	assert.Nil(t, a.Sign(crypto.GeneratePrivateKey()))
+	b := core.NewTransaction([]byte("foobar"))
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+
+	assert.Nil(t, p.Add(a))
+	assert.Nil(t, p.Add(b))
+	assert.Equal(t, 2, p.PendingCount())
+}
+
+func TestTxPoolRequeue(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+
+	p := NewTxPool(10)
+	chain := nonceMap{}
+	p.SetNonceSource(chain)
+
+	newTx := func(nonce uint64) *core.Transaction {
+		tx := utils.NewRandomTransaction(10)
+		tx.Nonce = nonce
+		assert.Nil(t, tx.Sign(privKey))
+		return tx
+	}
+
+	mined := newTx(0)
+	assert.Nil(t, p.Add(mined))
+	chain[sender] = 1
+	p.RemovePending([]*core.Transaction{mined})
+	assert.Equal(t, 0, p.PendingCount())
+
+	// the block with mined is dropped and the chain expects nonce 0 again,
+	// the plain Add of a known transaction does nothing
+	chain[sender] = 0
+	assert.Nil(t, p.Add(mined))
+	assert.Equal(t, 0, p.PendingCount())
+
+	assert.Equal(t, 1, p.Requeue([]*core.Transaction{mined}))
+	assert.Equal(t, []*core.Transaction{mined}, p.Pending())
+	assert.ErrorIs(t, p.Add(newTx(0)), core.ErrNonceTooLow)
+	next := newTx(1)
+	assert.Nil(t, p.Add(next))
+
+	// requeued transactions go ahead of the pending ones and are not
+	// duplicated
+	assert.Equal(t, 0, p.Requeue([]*core.Transaction{mined}))
+	assert.Equal(t, []*core.Transaction{mined, next}, p.Pending())
+}
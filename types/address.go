@@ -1,6 +1,23 @@
 package types
 
-import "encoding/hex"
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+const defaultAddressPrefix = "bcb"
+
+// AddressPrefix returns the human readable part of the bech32 addresses of the
+// chain with chainID. Chains other than the default chain 0 carry their id in
+// the prefix, so an address of one chain does not parse on another.
+func AddressPrefix(chainID uint64) string {
+	if chainID == 0 {
+		return defaultAddressPrefix
+	}
+
+	return defaultAddressPrefix + strconv.FormatUint(chainID, 10)
+}
 
 type Address [20]uint8
 
@@ -13,10 +30,68 @@ func (a Address) ToSlice() []byte {
 	return b
 }
 
+func (a Address) IsZero() bool {
+	for _, v := range a {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the checksummed bech32 form of the address with the default
+// prefix, which ParseAddress accepts on every chain. Use Bech32 with
+// AddressPrefix for the form of a specific chain.
 func (a Address) String() string {
+	return a.Bech32(defaultAddressPrefix)
+}
+
+// Bech32 returns the bech32 form of the address with prefix.
+func (a Address) Bech32(prefix string) string {
+	data, _ := convertBits(a.ToSlice(), 8, 5, true)
+	return bech32Encode(prefix, data)
+}
+
+// Hex returns the address as plain hex without a checksum.
+func (a Address) Hex() string {
 	return hex.EncodeToString(a.ToSlice())
 }
 
+// ParseAddress parses a bech32 address of the chain with chainID, rejecting
+// addresses with a wrong checksum or the prefix of another chain. The default
+// prefix written by String and MarshalText, which do not know the chain, is
+// accepted on every chain.
+func ParseAddress(s string, chainID uint64) (Address, error) {
+	addr, err := ParseAddressWithPrefix(s, AddressPrefix(chainID))
+	if err != nil && chainID != 0 {
+		if defaultAddr, defaultErr := ParseAddressWithPrefix(s, defaultAddressPrefix); defaultErr == nil {
+			return defaultAddr, nil
+		}
+	}
+
+	return addr, err
+}
+
+func ParseAddressWithPrefix(s, prefix string) (Address, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if hrp != prefix {
+		return Address{}, fmt.Errorf("invalid address prefix %q, expected %q", hrp, prefix)
+	}
+
+	b, err := convertBits(data, 5, 8, false)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(b) != 20 {
+		return Address{}, fmt.Errorf("invalid address length %d", len(b))
+	}
+
+	return AddressFromBytes(b), nil
+}
+
 func AddressFromBytes(b []byte) Address {
 	if len(b) != 20 {
 		panic("AddressFromBytes: invalid length")
@@ -29,3 +104,36 @@ func AddressFromBytes(b []byte) Address {
 
 	return Address(value)
 }
+
+func AddressFromHex(s string) (Address, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return Address{}, err
+	}
+
+	if len(b) != 20 {
+		return Address{}, fmt.Errorf("invalid address length %d", len(b))
+	}
+
+	return AddressFromBytes(b), nil
+}
+
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText reads the form written by MarshalText. Plain hex, the form
+// written before addresses were bech32, is still accepted.
+func (a *Address) UnmarshalText(text []byte) error {
+	addr, err := ParseAddress(string(text), 0)
+	if err != nil {
+		hexAddr, hexErr := AddressFromHex(string(text))
+		if hexErr != nil {
+			return err
+		}
+		addr = hexAddr
+	}
+
+	*a = addr
+	return nil
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBech32Vectors(t *testing.T) {
+	// valid and invalid strings from BIP 173
+	valid := []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	}
+	for _, s := range valid {
+		hrp, data, err := bech32Decode(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, strings.ToLower(s), bech32Encode(hrp, data))
+	}
+
+	invalid := []string{
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		"a12UEL5L",
+	}
+	for _, s := range invalid {
+		_, _, err := bech32Decode(s)
+		assert.ErrorIs(t, err, ErrInvalidBech32, s)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	addr := Address{0x0a, 0x0b, 0xff}
+
+	s := addr.String()
+	assert.True(t, strings.HasPrefix(s, AddressPrefix(0)+"1"))
+
+	parsed, err := ParseAddress(s, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+
+	parsed, err = ParseAddress(strings.ToUpper(s), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+
+	// a single mistyped character is caught by the checksum
+	typo := []byte(s)
+	if typo[10] == 'q' {
+		typo[10] = 'p'
+	} else {
+		typo[10] = 'q'
+	}
+	_, err = ParseAddress(string(typo), 0)
+	assert.ErrorIs(t, err, ErrInvalidBech32)
+
+	_, err = ParseAddress(addr.Bech32("tbcb"), 0)
+	assert.NotNil(t, err)
+
+	// an address of another chain does not parse
+	other := addr.Bech32(AddressPrefix(7))
+	_, err = ParseAddress(other, 0)
+	assert.NotNil(t, err)
+	_, err = ParseAddress(other, 8)
+	assert.NotNil(t, err)
+	parsed, err = ParseAddress(other, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+
+	// the chain neutral form of String parses on every chain
+	parsed, err = ParseAddress(addr.String(), 7)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+
+	parsed, err = ParseAddressWithPrefix(addr.Bech32("tbcb"), "tbcb")
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+}
+
+func TestAddressUnmarshalText(t *testing.T) {
+	addr := Address{0x0a, 0x0b, 0xff}
+
+	text, err := addr.MarshalText()
+	assert.Nil(t, err)
+
+	var parsed Address
+	assert.Nil(t, parsed.UnmarshalText(text))
+	assert.Equal(t, addr, parsed)
+
+	// hex is still accepted
+	parsed = Address{}
+	assert.Nil(t, parsed.UnmarshalText([]byte(addr.Hex())))
+	assert.Equal(t, addr, parsed)
+
+	assert.NotNil(t, parsed.UnmarshalText([]byte("foo")))
+}
@@ -42,3 +42,30 @@ func HashFromBytes(b []byte) Hash {
 
 	return Hash(value)
 }
+
+func HashFromHex(s string) (Hash, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	if len(b) != 32 {
+		return Hash{}, fmt.Errorf("invalid hash length %d", len(b))
+	}
+
+	return HashFromBytes(b), nil
+}
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	hash, err := HashFromHex(string(text))
+	if err != nil {
+		return err
+	}
+
+	*h = hash
+	return nil
+}
@@ -0,0 +1,33 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashAddressJSON(t *testing.T) {
+	v := struct {
+		Hash    Hash
+		Address Address
+	}{
+		Hash:    Hash{0x01, 0x02},
+		Address: Address{0xff},
+	}
+
+	b, err := json.Marshal(v)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"Hash": "0102000000000000000000000000000000000000000000000000000000000000",
+		"Address": "bcb1luqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq9m83k0"
+	}`, string(b))
+
+	decoded := v
+	decoded.Hash, decoded.Address = Hash{}, Address{}
+	assert.Nil(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, v, decoded)
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"Hash": "0102"}`), &decoded))
+	assert.NotNil(t, json.Unmarshal([]byte(`{"Address": "zz"}`), &decoded))
+}
@@ -0,0 +1,221 @@
+package wallet
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/dbkbali/bcbasic/crypto"
+)
+
+// HardenedOffset is added to a child index to derive a hardened child, which
+// can not be derived from the parent public key.
+const HardenedOffset uint32 = 0x80000000
+
+var (
+	ErrInvalidPath   = errors.New("invalid derivation path")
+	ErrInvalidSeed   = errors.New("invalid seed")
+	ErrUnsupportedHD = errors.New("unsupported derivation")
+)
+
+// hdCurve holds what derivation needs to know about a scheme: the HMAC key of
+// the master key and, for ECDSA schemes, the group order. Ed25519 keys have
+// no order and only have hardened children, as in SLIP-0010.
+type hdCurve struct {
+	seedKey string
+	n       *big.Int
+}
+
+var hdCurves = map[crypto.Scheme]hdCurve{
+	crypto.SchemeP256:    {seedKey: "Nist256p1 seed", n: elliptic.P256().Params().N},
+	crypto.SchemeEd25519: {seedKey: "ed25519 seed"},
+}
+
+// Key is an extended private key: a private key and the chain code its
+// children are derived with. Keys derive as in SLIP-0010, which is BIP32 over
+// P-256 and Ed25519. Secp256k1 is verify only, so it has no wallet keys.
+type Key struct {
+	scheme    crypto.Scheme
+	key       []byte
+	chainCode []byte
+	depth     uint8
+	index     uint32
+}
+
+// NewMasterKey derives the master key of scheme from seed.
+func NewMasterKey(seed []byte, scheme crypto.Scheme) (*Key, error) {
+	curve, ok := hdCurves[scheme]
+	if !ok {
+		return nil, fmt.Errorf("%w: scheme %s", ErrUnsupportedHD, scheme)
+	}
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("%w: %d bytes, expected 16 to 64", ErrInvalidSeed, len(seed))
+	}
+
+	I := hmacSHA512([]byte(curve.seedKey), seed)
+	for curve.n != nil && !validScalar(I[:32], curve.n) {
+		I = hmacSHA512([]byte(curve.seedKey), I)
+	}
+
+	return &Key{
+		scheme:    scheme,
+		key:       I[:32],
+		chainCode: I[32:],
+	}, nil
+}
+
+// NewMasterKeyFromMnemonic derives the master key of scheme from the seed of
+// mnemonic and passphrase.
+func NewMasterKeyFromMnemonic(mnemonic, passphrase string, scheme crypto.Scheme) (*Key, error) {
+	seed, err := SeedFromMnemonic(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMasterKey(seed, scheme)
+}
+
+// Child derives the child at index. Indexes from HardenedOffset on derive
+// hardened children.
+func (k *Key) Child(index uint32) (*Key, error) {
+	curve := hdCurves[k.scheme]
+	hardened := index >= HardenedOffset
+
+	data := make([]byte, 0, 37)
+	if hardened {
+		data = append(append(data, 0x00), k.key...)
+	} else {
+		if curve.n == nil {
+			return nil, fmt.Errorf("%w: %s keys only have hardened children", ErrUnsupportedHD, k.scheme)
+		}
+		signer, err := k.Signer()
+		if err != nil {
+			return nil, err
+		}
+		// the compressed public key, without the scheme byte
+		data = append(data, signer.PublicKey()[1:]...)
+	}
+	data = appendUint32(data, index)
+
+	child := &Key{
+		scheme: k.scheme,
+		depth:  k.depth + 1,
+		index:  index,
+	}
+
+	I := hmacSHA512(k.chainCode, data)
+	if curve.n == nil {
+		child.key, child.chainCode = I[:32], I[32:]
+		return child, nil
+	}
+
+	for {
+		if validScalar(I[:32], curve.n) {
+			d := new(big.Int).SetBytes(I[:32])
+			d.Add(d, new(big.Int).SetBytes(k.key))
+			d.Mod(d, curve.n)
+			if d.Sign() != 0 {
+				child.key, child.chainCode = d.FillBytes(make([]byte, 32)), I[32:]
+				return child, nil
+			}
+		}
+
+		// the child key is invalid, retry with the chain code as SLIP-0010
+		// does
+		data = append([]byte{0x01}, I[32:]...)
+		data = appendUint32(data, index)
+		I = hmacSHA512(k.chainCode, data)
+	}
+}
+
+// Derive derives the key at path, such as "m/44'/0'/0'/0/1". A trailing ' or
+// h marks a hardened index.
+func (k *Key) Derive(path string) (*Key, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// ParsePath returns the child indexes of a path starting at the master key m.
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("%w: %q does not start with m", ErrInvalidPath, path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		var offset uint32
+		if trimmed := strings.TrimRight(part, "'hH"); len(trimmed) == len(part)-1 {
+			part, offset = trimmed, HardenedOffset
+		}
+
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedOffset {
+			return nil, fmt.Errorf("%w: bad index %q in %q", ErrInvalidPath, part, path)
+		}
+
+		indexes = append(indexes, uint32(index)+offset)
+	}
+
+	return indexes, nil
+}
+
+// Signer returns the private key of k as a signer of its scheme.
+func (k *Key) Signer() (crypto.Signer, error) {
+	switch k.scheme {
+	case crypto.SchemeP256:
+		return crypto.PrivateKeyFromBytes(k.key)
+	case crypto.SchemeEd25519:
+		return crypto.Ed25519PrivateKeyFromSeed(k.key)
+	default:
+		return nil, fmt.Errorf("%w: scheme %s", ErrUnsupportedHD, k.scheme)
+	}
+}
+
+func (k *Key) Scheme() crypto.Scheme { return k.scheme }
+
+// PrivateKey returns the 32 private key bytes: the scalar of ECDSA keys, the
+// seed of Ed25519 keys.
+func (k *Key) PrivateKey() []byte { return append([]byte(nil), k.key...) }
+
+func (k *Key) ChainCode() []byte { return append([]byte(nil), k.chainCode...) }
+
+// Depth is the number of derivations from the master key.
+func (k *Key) Depth() uint8 { return k.depth }
+
+// Index is the index k was derived with, zero for the master key.
+func (k *Key) Index() uint32 { return k.index }
+
+func validScalar(b []byte, n *big.Int) bool {
+	d := new(big.Int).SetBytes(b)
+	return d.Sign() != 0 && d.Cmp(n) < 0
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
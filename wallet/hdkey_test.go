@@ -0,0 +1,102 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/dbkbali/bcbasic/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+const vectorSeed = "000102030405060708090a0b0c0d0e0f"
+
+// Test vector 1 of SLIP-0010 for P-256 and Ed25519. The P-256 path mixes
+// hardened and non-hardened steps.
+var derivationVectors = []struct {
+	scheme    crypto.Scheme
+	path      string
+	chainCode string
+	key       string
+}{
+	{crypto.SchemeP256, "m", "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+	{crypto.SchemeP256, "m/0'", "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+	{crypto.SchemeP256, "m/0'/1", "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c", "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+	{crypto.SchemeP256, "m/0'/1/2'", "98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318", "694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7"},
+	{crypto.SchemeP256, "m/0'/1/2'/2", "ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0", "5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa"},
+	{crypto.SchemeP256, "m/0'/1/2'/2/1000000000", "b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059", "21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119"},
+	{crypto.SchemeEd25519, "m", "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb", "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+	{crypto.SchemeEd25519, "m/0'", "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69", "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3"},
+	{crypto.SchemeEd25519, "m/0'/1'", "a320425f77d1b5c2505a6b1b27382b37368ee640e3557c315416801243552f14", "b1d0bad404bf35da785a64ca1ac54b2617211d2777696fbffaf208f746ae84f2"},
+}
+
+func TestDerivationVectors(t *testing.T) {
+	seed, _ := hex.DecodeString(vectorSeed)
+
+	for _, v := range derivationVectors {
+		master, err := NewMasterKey(seed, v.scheme)
+		assert.Nil(t, err)
+
+		key, err := master.Derive(v.path)
+		assert.Nil(t, err)
+		assert.Equal(t, v.chainCode, hex.EncodeToString(key.ChainCode()), "%s %s", v.scheme, v.path)
+		assert.Equal(t, v.key, hex.EncodeToString(key.PrivateKey()), "%s %s", v.scheme, v.path)
+	}
+}
+
+func TestDerivedKeySigns(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+	master, err := NewMasterKeyFromMnemonic(mnemonic, "", crypto.SchemeP256)
+	assert.Nil(t, err)
+
+	key, err := master.Derive("m/44'/0'/0'/0/1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(5), key.Depth())
+	assert.Equal(t, uint32(1), key.Index())
+
+	signer, err := key.Signer()
+	assert.Nil(t, err)
+
+	sig, err := signer.Sign([]byte("foo"))
+	assert.Nil(t, err)
+	assert.True(t, sig.Verify(signer.PublicKey(), []byte("foo")))
+
+	// the same path always derives the same key
+	again, err := master.Derive("m/44h/0h/0h/0/1")
+	assert.Nil(t, err)
+	assert.Equal(t, key.PrivateKey(), again.PrivateKey())
+
+	other, err := master.Derive("m/44'/0'/0'/0/2")
+	assert.Nil(t, err)
+	assert.NotEqual(t, key.PrivateKey(), other.PrivateKey())
+}
+
+func TestSecp256k1Unsupported(t *testing.T) {
+	seed, _ := hex.DecodeString(vectorSeed)
+	_, err := NewMasterKey(seed, crypto.SchemeSecp256k1)
+	assert.ErrorIs(t, err, ErrUnsupportedHD)
+}
+
+func TestEd25519OnlyHardened(t *testing.T) {
+	seed, _ := hex.DecodeString(vectorSeed)
+	master, err := NewMasterKey(seed, crypto.SchemeEd25519)
+	assert.Nil(t, err)
+
+	_, err = master.Derive("m/0")
+	assert.ErrorIs(t, err, ErrUnsupportedHD)
+}
+
+func TestParsePath(t *testing.T) {
+	indexes, err := ParsePath("m/44'/0h/1")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{44 + HardenedOffset, HardenedOffset, 1}, indexes)
+
+	indexes, err = ParsePath("m")
+	assert.Nil(t, err)
+	assert.Empty(t, indexes)
+
+	for _, path := range []string{"", "44'/0", "m/", "m/x", "m/1''", "m/2147483648"} {
+		_, err := ParsePath(path)
+		assert.ErrorIs(t, err, ErrInvalidPath, path)
+	}
+}
@@ -0,0 +1,124 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	seedIterations = 2048
+	seedSize       = 64
+)
+
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+var wordIndex = func() map[string]int {
+	m := make(map[string]int, len(englishWords))
+	for i, w := range englishWords {
+		m[w] = i
+	}
+
+	return m
+}()
+
+// NewEntropy returns bits of random entropy for a mnemonic. bits must be a
+// multiple of 32 between 128 and 256.
+func NewEntropy(bits int) ([]byte, error) {
+	if err := validateEntropySize(bits); err != nil {
+		return nil, err
+	}
+
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, err
+	}
+
+	return entropy, nil
+}
+
+// NewMnemonic returns the BIP39 mnemonic of entropy: the entropy followed by
+// the first len(entropy)/4 bits of its SHA-256, split into 11 bit word
+// indexes.
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if err := validateEntropySize(bits); err != nil {
+		return "", err
+	}
+
+	checksumBits := bits / 32
+	checksum := sha256.Sum256(entropy)
+
+	n := new(big.Int).SetBytes(entropy)
+	n.Lsh(n, uint(checksumBits))
+	n.Or(n, big.NewInt(int64(checksum[0]>>(8-checksumBits))))
+
+	words := make([]string, (bits+checksumBits)/11)
+	mask := big.NewInt(0x7ff)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = englishWords[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 11)
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// EntropyFromMnemonic is the inverse of NewMnemonic. It fails on unknown
+// words and on a wrong checksum.
+func EntropyFromMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, fmt.Errorf("%w: %d words", ErrInvalidMnemonic, len(words))
+	}
+
+	n := new(big.Int)
+	for _, w := range words {
+		i, ok := wordIndex[w]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, w)
+		}
+		n.Lsh(n, 11)
+		n.Or(n, big.NewInt(int64(i)))
+	}
+
+	checksumBits := len(words) * 11 / 33
+	checksum := byte(new(big.Int).And(n, big.NewInt(1<<checksumBits-1)).Int64())
+	n.Rsh(n, uint(checksumBits))
+
+	entropy := n.FillBytes(make([]byte, checksumBits*4))
+	if h := sha256.Sum256(entropy); h[0]>>(8-checksumBits) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidMnemonic)
+	}
+
+	return entropy, nil
+}
+
+// SeedFromMnemonic checks mnemonic and derives the 64 byte BIP39 seed from it
+// and passphrase with PBKDF2-HMAC-SHA512. Both are NFKD normalized first, as
+// BIP39 requires, so a passphrase typed with composed or decomposed accents
+// gives the same seed.
+func SeedFromMnemonic(mnemonic, passphrase string) ([]byte, error) {
+	mnemonic = norm.NFKD.String(mnemonic)
+	if _, err := EntropyFromMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	salt := "mnemonic" + norm.NFKD.String(passphrase)
+	return pbkdf2.Key([]byte(normalized), []byte(salt), seedIterations, seedSize, sha512.New), nil
+}
+
+func validateEntropySize(bits int) error {
+	if bits%32 != 0 || bits < 128 || bits > 256 {
+		return fmt.Errorf("%w: entropy of %d bits", ErrInvalidMnemonic, bits)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// BIP39 test vectors, with the passphrase "TREZOR".
+var mnemonicVectors = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		"80808080808080808080808080808080",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+		"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+	},
+	{
+		"ffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+	},
+	{
+		"9e885d952ad362caeb4efe34a8e91bd2",
+		"ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic",
+		"274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e5476c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+		"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+	},
+}
+
+func TestWordlist(t *testing.T) {
+	assert.Len(t, englishWords, 2048)
+	assert.True(t, sort.StringsAreSorted(englishWords))
+
+	prefixes := make(map[string]bool)
+	for _, w := range englishWords {
+		if len(w) > 4 {
+			w = w[:4]
+		}
+		assert.False(t, prefixes[w], w)
+		prefixes[w] = true
+	}
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	for _, v := range mnemonicVectors {
+		entropy, _ := hex.DecodeString(v.entropy)
+
+		mnemonic, err := NewMnemonic(entropy)
+		assert.Nil(t, err)
+		assert.Equal(t, v.mnemonic, mnemonic)
+
+		decoded, err := EntropyFromMnemonic(mnemonic)
+		assert.Nil(t, err)
+		assert.Equal(t, entropy, decoded)
+
+		seed, err := SeedFromMnemonic(mnemonic, "TREZOR")
+		assert.Nil(t, err)
+		assert.Equal(t, v.seed, hex.EncodeToString(seed))
+	}
+}
+
+func TestMnemonicRoundTrip(t *testing.T) {
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		entropy, err := NewEntropy(bits)
+		assert.Nil(t, err)
+
+		mnemonic, err := NewMnemonic(entropy)
+		assert.Nil(t, err)
+		assert.Len(t, strings.Fields(mnemonic), (bits+bits/32)/11)
+
+		decoded, err := EntropyFromMnemonic(mnemonic)
+		assert.Nil(t, err)
+		assert.Equal(t, entropy, decoded)
+	}
+
+	_, err := NewEntropy(100)
+	assert.ErrorIs(t, err, ErrInvalidMnemonic)
+}
+
+func TestSeedNormalizesPassphrase(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+	composed, err := SeedFromMnemonic(mnemonic, "caf\u00e9")
+	assert.Nil(t, err)
+	decomposed, err := SeedFromMnemonic(mnemonic, "cafe\u0301")
+	assert.Nil(t, err)
+	assert.Equal(t, composed, decomposed)
+
+	other, err := SeedFromMnemonic(mnemonic, "cafe")
+	assert.Nil(t, err)
+	assert.NotEqual(t, composed, other)
+}
+
+func TestInvalidMnemonic(t *testing.T) {
+	// last word changed, so the checksum does not match
+	_, err := EntropyFromMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")
+	assert.ErrorIs(t, err, ErrInvalidMnemonic)
+
+	_, err = EntropyFromMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon bitcoin")
+	assert.ErrorIs(t, err, ErrInvalidMnemonic)
+
+	_, err = SeedFromMnemonic("abandon about", "")
+	assert.ErrorIs(t, err, ErrInvalidMnemonic)
+}